@@ -2,17 +2,36 @@ package log_v1
 
 import (
 	"fmt"
+	"strconv"
 
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+const (
+	// ErrorDomain is the domain of the ErrorInfo details of the errors.
+	ErrorDomain = "proglog"
+	// ReasonOffsetExpired is the reason of an OffsetOutOfRangeError for an
+	// offset retention removed. Its ErrorInfo holds the lowest offset left,
+	// where the consumer can resume, under LowestOffsetMetadataKey.
+	ReasonOffsetExpired     = "OFFSET_EXPIRED"
+	LowestOffsetMetadataKey = "lowest_offset"
+)
+
+// OffsetOutOfRangeError is NotFound for an offset past the end of the
+// partition, which a consumer waits for, and OutOfRange for one retention
+// removed, which it must skip.
 type OffsetOutOfRangeError struct {
 	Offset uint64
+	Lowest uint64
 }
 
 func (e OffsetOutOfRangeError) GRPCStatus() *status.Status {
+	if e.Offset < e.Lowest {
+		return e.expiredStatus()
+	}
+
 	st := status.New(codes.NotFound, fmt.Sprintf("offset out of range: %d", e.Offset))
 	msg := fmt.Sprintf("The requested offset is outside the log's range: %d", e.Offset)
 
@@ -29,6 +48,452 @@ func (e OffsetOutOfRangeError) GRPCStatus() *status.Status {
 	return std
 }
 
+func (e OffsetOutOfRangeError) expiredStatus() *status.Status {
+	st := status.New(codes.OutOfRange, fmt.Sprintf("offset removed by retention: %d, lowest offset: %d", e.Offset, e.Lowest))
+	msg := fmt.Sprintf("The requested offset %d has been removed, the lowest offset in the log is %d", e.Offset, e.Lowest)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	info := &errdetails.ErrorInfo{
+		Reason: ReasonOffsetExpired,
+		Domain: ErrorDomain,
+		Metadata: map[string]string{
+			LowestOffsetMetadataKey: strconv.FormatUint(e.Lowest, 10),
+		},
+	}
+
+	std, err := st.WithDetails(d, info)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
 func (e OffsetOutOfRangeError) Error() string {
 	return e.GRPCStatus().Err().Error()
 }
+
+type CorruptRecordError struct {
+	Offset uint64
+	Pos    uint64
+}
+
+func (e CorruptRecordError) GRPCStatus() *status.Status {
+	st := status.New(codes.DataLoss, fmt.Sprintf("corrupt record: offset %d at position %d", e.Offset, e.Pos))
+	msg := fmt.Sprintf("The record at offset %d is corrupted on disk", e.Offset)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e CorruptRecordError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type TopicNotFoundError struct {
+	Topic string
+}
+
+func (e TopicNotFoundError) GRPCStatus() *status.Status {
+	st := status.New(codes.NotFound, fmt.Sprintf("topic not found: %s", e.Topic))
+	msg := fmt.Sprintf("The topic %q doesn't exist", e.Topic)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e TopicNotFoundError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type TopicExistsError struct {
+	Topic string
+}
+
+func (e TopicExistsError) GRPCStatus() *status.Status {
+	st := status.New(codes.AlreadyExists, fmt.Sprintf("topic already exists: %s", e.Topic))
+	msg := fmt.Sprintf("The topic %q already exists", e.Topic)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e TopicExistsError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type InvalidTopicError struct {
+	Topic  string
+	Reason string
+}
+
+func (e InvalidTopicError) GRPCStatus() *status.Status {
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("invalid topic %q: %s", e.Topic, e.Reason))
+	msg := fmt.Sprintf("The topic %q is invalid: %s", e.Topic, e.Reason)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e InvalidTopicError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type InvalidGroupError struct {
+	Group  string
+	Reason string
+}
+
+func (e InvalidGroupError) GRPCStatus() *status.Status {
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("invalid group %q: %s", e.Group, e.Reason))
+	msg := fmt.Sprintf("The consumer group %q is invalid: %s", e.Group, e.Reason)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e InvalidGroupError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type PartitionNotFoundError struct {
+	Topic     string
+	Partition uint32
+}
+
+func (e PartitionNotFoundError) GRPCStatus() *status.Status {
+	st := status.New(codes.NotFound, fmt.Sprintf("partition not found: %s/%d", e.Topic, e.Partition))
+	msg := fmt.Sprintf("The topic %q has no partition %d", e.Topic, e.Partition)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e PartitionNotFoundError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type OffsetNotCommittedError struct {
+	Group     string
+	Topic     string
+	Partition uint32
+}
+
+func (e OffsetNotCommittedError) GRPCStatus() *status.Status {
+	st := status.New(codes.NotFound, fmt.Sprintf("no committed offset: %s %s/%d", e.Group, e.Topic, e.Partition))
+	msg := fmt.Sprintf("The group %q has no committed offset for partition %d of the topic %q", e.Group, e.Partition, e.Topic)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e OffsetNotCommittedError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type UnknownMemberError struct {
+	Group    string
+	MemberID string
+}
+
+func (e UnknownMemberError) GRPCStatus() *status.Status {
+	st := status.New(codes.NotFound, fmt.Sprintf("unknown member: %s %s", e.Group, e.MemberID))
+	msg := fmt.Sprintf("The member %q isn't in the group %q", e.MemberID, e.Group)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e UnknownMemberError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type StaleGenerationError struct {
+	Group      string
+	Generation uint64
+	Current    uint64
+}
+
+func (e StaleGenerationError) GRPCStatus() *status.Status {
+	st := status.New(codes.FailedPrecondition, fmt.Sprintf("stale generation: %s %d, current %d", e.Group, e.Generation, e.Current))
+	msg := fmt.Sprintf("The generation %d of the group %q is over, rejoin the group to get generation %d", e.Generation, e.Group, e.Current)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e StaleGenerationError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type UnknownProducerError struct {
+	ProducerID uint64
+}
+
+func (e UnknownProducerError) GRPCStatus() *status.Status {
+	st := status.New(codes.NotFound, fmt.Sprintf("unknown producer: %d", e.ProducerID))
+	msg := fmt.Sprintf("The producer %d doesn't exist, init a new producer", e.ProducerID)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e UnknownProducerError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type ProducerFencedError struct {
+	ProducerID uint64
+	Epoch      uint32
+	Current    uint32
+}
+
+func (e ProducerFencedError) GRPCStatus() *status.Status {
+	st := status.New(codes.FailedPrecondition, fmt.Sprintf("producer fenced: %d epoch %d, current %d", e.ProducerID, e.Epoch, e.Current))
+	msg := fmt.Sprintf("The epoch %d of the producer %d was fenced off by epoch %d", e.Epoch, e.ProducerID, e.Current)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e ProducerFencedError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type DuplicateSequenceError struct {
+	ProducerID uint64
+	Sequence   uint64
+}
+
+func (e DuplicateSequenceError) GRPCStatus() *status.Status {
+	st := status.New(codes.AlreadyExists, fmt.Sprintf("duplicate sequence: %d %d", e.ProducerID, e.Sequence))
+	msg := fmt.Sprintf("The sequence %d of the producer %d was already appended too long ago to return its offset", e.Sequence, e.ProducerID)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e DuplicateSequenceError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type TxnNotOpenError struct {
+	TxnID uint64
+}
+
+func (e TxnNotOpenError) GRPCStatus() *status.Status {
+	st := status.New(codes.FailedPrecondition, fmt.Sprintf("transaction not open: %d", e.TxnID))
+	msg := fmt.Sprintf("The transaction %d doesn't exist or has already ended", e.TxnID)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e TxnNotOpenError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// TxnProducerError fails the requests of a transaction sent by another
+// producer, or another epoch of the producer, than the one that began it.
+type TxnProducerError struct {
+	TxnID      uint64
+	ProducerID uint64
+	Epoch      uint32
+}
+
+func (e TxnProducerError) GRPCStatus() *status.Status {
+	st := status.New(codes.PermissionDenied, fmt.Sprintf("transaction of another producer: %d, producer %d epoch %d", e.TxnID, e.ProducerID, e.Epoch))
+	msg := fmt.Sprintf("The transaction %d wasn't begun by the epoch %d of the producer %d", e.TxnID, e.Epoch, e.ProducerID)
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e TxnProducerError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type NotLeaderError struct {
+	// Leader is the address of the leader, empty when it isn't known.
+	Leader string
+}
+
+func (e NotLeaderError) GRPCStatus() *status.Status {
+	st := status.New(codes.FailedPrecondition, fmt.Sprintf("not the leader, leader: %q", e.Leader))
+	msg := "The server isn't the leader, send the request to the leader"
+	if e.Leader != "" {
+		msg = fmt.Sprintf("The server isn't the leader, send the request to the leader at %s", e.Leader)
+	}
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e NotLeaderError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// LeadershipLostError fails a request whose leader lost its leadership after
+// appending it to the raft log. The next leader may still commit it, so its
+// outcome is unknown and it is only safe to send again when it's idempotent.
+type LeadershipLostError struct{}
+
+func (e LeadershipLostError) GRPCStatus() *status.Status {
+	st := status.New(codes.Unavailable, "leadership lost, outcome unknown")
+	msg := "The server lost its leadership before the request was committed, it may or may not have been applied"
+
+	d := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: msg,
+	}
+
+	std, err := st.WithDetails(d)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
+func (e LeadershipLostError) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
@@ -0,0 +1,15 @@
+package log_v1
+
+import "strings"
+
+// DefaultTopic is the topic of the requests that don't name one.
+const DefaultTopic = "default"
+
+// InternalTopicPrefix starts the names of the topics a node keeps for
+// itself. Clients can't create, delete, produce to or consume from them.
+const InternalTopicPrefix = "__"
+
+// IsInternalTopic reports whether the topic is one a node keeps for itself.
+func IsInternalTopic(name string) bool {
+	return strings.HasPrefix(name, InternalTopicPrefix)
+}
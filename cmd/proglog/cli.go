@@ -6,12 +6,14 @@ import (
 	"os/signal"
 	"path"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/huytran2000-hcmus/proglog/internal/agent"
 	"github.com/huytran2000-hcmus/proglog/internal/config"
+	"github.com/huytran2000-hcmus/proglog/internal/log"
 )
 
 var version string
@@ -67,6 +69,25 @@ func (c *cli) setupConfig(cmd *cobra.Command, args []string) error {
 	c.cfg.RPCPort = viper.GetInt("rpc-port")
 	c.cfg.StartPointAddrs = viper.GetStringSlice("start-join-addrs")
 	c.cfg.Bootstrap = viper.GetBool("bootstrap")
+	c.cfg.Compression, err = log.ParseCodec(viper.GetString("compression"))
+	if err != nil {
+		return fmt.Errorf("parse compression codec: %w", err)
+	}
+	c.cfg.EncryptionKeyFile = viper.GetString("encryption-key-file")
+	c.cfg.SyncPolicy, err = log.ParseSyncPolicy(viper.GetString("sync-policy"))
+	if err != nil {
+		return fmt.Errorf("parse sync policy: %w", err)
+	}
+	c.cfg.SyncEveryN = viper.GetUint64("sync-every-n")
+	c.cfg.SyncInterval = viper.GetDuration("sync-interval")
+	c.cfg.RetentionMaxAge = viper.GetDuration("retention-max-age")
+	c.cfg.RetentionMaxBytes = viper.GetUint64("retention-max-bytes")
+	c.cfg.Compaction = viper.GetBool("compaction")
+	c.cfg.Partitions = viper.GetUint32("partitions")
+	c.cfg.TxnTimeout = viper.GetDuration("txn-timeout")
+	c.cfg.LongPollTimeout = viper.GetDuration("long-poll-timeout")
+	c.cfg.MaxForwardHops = viper.GetInt("max-forward-hops")
+	c.cfg.AllowedOrigins = viper.GetStringSlice("allowed-origins")
 	c.cfg.ACLModelFile = viper.GetString("acl-mode-file")
 	c.cfg.ACLPolicyFile = viper.GetString("acl-policy-file")
 	c.cfg.ServerTLSConfig.CertFile = viper.GetString("server-tls-cert-file")
@@ -108,6 +129,19 @@ func setupFlags(cmd *cobra.Command) error {
 	cmd.Flags().Int("rpc-port", 8400, "Port for RPC clients (and Raft) connections.")
 	cmd.Flags().StringSlice("start-join-addrs", nil, "Serf addresses to join.")
 	cmd.Flags().Bool("bootstrap", false, "Bootstrap the cluster.")
+	cmd.Flags().String("compression", log.CodecNone.String(), "Codec to compress the records appended together with: none, gzip, snappy or zstd.")
+	cmd.Flags().String("encryption-key-file", "", "Path to the JSON file of keys to encrypt the log with. The log is stored in plaintext without it.")
+	cmd.Flags().String("sync-policy", log.SyncNever.String(), "When to fsync appended records: never, always, every-n or interval.")
+	cmd.Flags().Uint64("sync-every-n", 1000, "Number of appended records between fsyncs with the every-n sync policy.")
+	cmd.Flags().Duration("sync-interval", time.Second, "Time between fsyncs with the interval sync policy.")
+	cmd.Flags().Duration("retention-max-age", 0, "Remove log segments whose newest record is older than this. Zero keeps them forever.")
+	cmd.Flags().Uint64("retention-max-bytes", 0, "Remove the oldest log segments while the log is larger than this. Zero keeps them forever.")
+	cmd.Flags().Bool("compaction", false, "Compact the log, keeping only the newest record of every key.")
+	cmd.Flags().Uint32("partitions", 1, "Number of partitions of the default topic and of the topics created without one.")
+	cmd.Flags().Duration("txn-timeout", time.Minute, "Abort the transactions still open this long after they began.")
+	cmd.Flags().Duration("long-poll-timeout", 0, "End consume streams that waited this long for a new record. Zero waits as long as the stream is open.")
+	cmd.Flags().Int("max-forward-hops", 1, "Number of times a request that only the leader serves may be forwarded between servers.")
+	cmd.Flags().StringSlice("allowed-origins", nil, "Origins besides the server's own that browsers may tail the log from over a WebSocket.")
 	cmd.Flags().String("acl-model-file", "", "Path to ACL model.")
 	cmd.Flags().String("acl-policy-file", "", "Path to ACL policy.")
 	cmd.Flags().String("server-tls-cert-file", "", "Path to server tls cert.")
@@ -3,10 +3,12 @@ package agent
 import (
 	"bytes"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	glog "log"
 	"net"
+	"net/http"
 	"sync"
 	"time"
 
@@ -15,6 +17,7 @@ import (
 	"github.com/soheilhy/cmux"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/huytran2000-hcmus/proglog/internal/auth"
 	"github.com/huytran2000-hcmus/proglog/internal/discovery"
@@ -28,6 +31,8 @@ type Agent struct {
 	log *log.Distributed
 
 	server     *grpc.Server
+	httpServer *http.Server
+	forwarder  *server.Forwarder
 	membership *discovery.Membership
 	mux        cmux.CMux
 
@@ -42,6 +47,33 @@ type Config struct {
 	DataDir       string
 	MaxStoreBytes uint64
 	MaxIndexBytes uint64
+	Compression   log.Codec
+	// EncryptionKeyFile is a JSON file of the keys to encrypt the log with.
+	// The log is stored in plaintext when it is empty.
+	EncryptionKeyFile string
+
+	SyncPolicy   log.SyncPolicy
+	SyncEveryN   uint64
+	SyncInterval time.Duration
+
+	RetentionMaxAge   time.Duration
+	RetentionMaxBytes uint64
+
+	Compaction bool
+	// Partitions is the number of partitions of the default topic and of
+	// the topics created without a partition count.
+	Partitions uint32
+	// TxnTimeout is how long a transaction may stay open before the leader
+	// aborts it.
+	TxnTimeout time.Duration
+
+	LongPollTimeout time.Duration
+	// MaxForwardHops is how many times a request only the leader serves may
+	// be forwarded between servers.
+	MaxForwardHops int
+	// AllowedOrigins are the origins besides the agent's own that browsers
+	// may tail the log from over a WebSocket.
+	AllowedOrigins []string
 
 	ServerTLSConfig *tls.Config
 	PeerTLSConfig   *tls.Config
@@ -99,6 +131,8 @@ func (a *Agent) Shutdown() error {
 			a.server.GracefulStop()
 			return nil
 		},
+		a.httpServer.Close,
+		a.forwarder.Close,
 		a.log.Close,
 	}
 
@@ -143,10 +177,21 @@ func (a *Agent) setupMembership() error {
 func (a *Agent) setupServer() error {
 	authorizer := auth.New(a.ACLModelFile, a.ACLPolicyFile)
 
+	// followers forward to the leader with the identity they replicate with
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if a.PeerTLSConfig != nil {
+		dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(a.PeerTLSConfig))}
+	}
+	a.forwarder = server.NewForwarder(dialOpts...)
+
 	config := &server.Config{
-		CommitLog:   a.log,
-		Authorizer:  authorizer,
-		GetServerer: a.log,
+		CommitLog:       a.log,
+		Authorizer:      authorizer,
+		GetServerer:     a.log,
+		LongPollTimeout: a.LongPollTimeout,
+		Forwarder:       a.forwarder,
+		MaxForwardHops:  a.MaxForwardHops,
+		AllowedOrigins:  a.AllowedOrigins,
 	}
 
 	var opts []grpc.ServerOption
@@ -161,6 +206,11 @@ func (a *Agent) setupServer() error {
 		return fmt.Errorf("create grpc server: %w", err)
 	}
 
+	err = a.setupHTTP(config)
+	if err != nil {
+		return fmt.Errorf("set up http server: %w", err)
+	}
+
 	grpcLn := a.mux.Match(cmux.Any())
 	go func() {
 		err := a.server.Serve(grpcLn)
@@ -172,6 +222,38 @@ func (a *Agent) setupServer() error {
 	return err
 }
 
+// setupHTTP serves the HTTP/JSON API on the connections of HTTP/1 clients.
+// With TLS, they are told apart from the gRPC ones by the protocols their
+// TLS handshake offers, since gRPC clients always offer HTTP/2.
+func (a *Agent) setupHTTP(config *server.Config) error {
+	handler, err := server.NewHTTPHandler(config)
+	if err != nil {
+		return err
+	}
+	a.httpServer = &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	var httpLn net.Listener
+	if a.ServerTLSConfig != nil {
+		tlsConfig := a.ServerTLSConfig.Clone()
+		tlsConfig.NextProtos = []string{"http/1.1"}
+		httpLn = tls.NewListener(a.mux.Match(tlsWithoutHTTP2), tlsConfig)
+	} else {
+		httpLn = a.mux.Match(cmux.HTTP1Fast())
+	}
+
+	go func() {
+		err := a.httpServer.Serve(httpLn)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			_ = a.Shutdown()
+		}
+	}()
+
+	return nil
+}
+
 func (a *Agent) setupLog() error {
 	raftLn := a.mux.Match(func(r io.Reader) bool {
 		b := make([]byte, 1)
@@ -183,6 +265,22 @@ func (a *Agent) setupLog() error {
 		return bytes.Compare(b, []byte{byte(log.RaftRPC)}) == 0
 	})
 	logConfig := log.Config{}
+	logConfig.Segment.Compression = a.Compression
+	logConfig.Sync.Policy = a.SyncPolicy
+	logConfig.Sync.EveryN = a.SyncEveryN
+	logConfig.Sync.Interval = a.SyncInterval
+	logConfig.Retention.MaxAge = a.RetentionMaxAge
+	logConfig.Retention.MaxBytes = a.RetentionMaxBytes
+	logConfig.Compaction.Enabled = a.Compaction
+	logConfig.Topic.Partitions = a.Partitions
+	logConfig.Txn.Timeout = a.TxnTimeout
+	if a.EncryptionKeyFile != "" {
+		keyring, err := log.LoadKeyring(a.EncryptionKeyFile)
+		if err != nil {
+			return fmt.Errorf("load encryption keys: %w", err)
+		}
+		logConfig.Encryption.Keyring = keyring
+	}
 	logConfig.Raft.Stream = log.NewStreamLayer(raftLn, a.ServerTLSConfig, a.PeerTLSConfig)
 	rpcAddr, err := a.Config.RPCAddr()
 	if err != nil {
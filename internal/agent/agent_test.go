@@ -1,17 +1,25 @@
 package agent_test
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/travisjeffery/go-dynaport"
+	"golang.org/x/net/websocket"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 
 	api "github.com/huytran2000-hcmus/proglog/api/v1"
 	"github.com/huytran2000-hcmus/proglog/internal/agent"
@@ -104,13 +112,159 @@ func TestAgent(t *testing.T) {
 	testhelper.RequireNoError(t, err)
 	testhelper.AssertEqual(t, want, consume.Record.Value)
 
-	consume, err = leaderClient.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset + 1})
+	// a follower forwards the produces of the clients that dial it directly
+	rpcAddr, err := agents[1].RPCAddr()
+	testhelper.RequireNoError(t, err)
+	conn, err := grpc.Dial(rpcAddr, grpc.WithTransportCredentials(credentials.NewTLS(peerTLSCfg)))
+	testhelper.RequireNoError(t, err)
+	defer conn.Close()
+
+	forwarded, err := api.NewLogClient(conn).Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: want},
+	})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, produce.Offset+1, forwarded.Offset)
+
+	// the HTTP/JSON API shares the port of the gRPC one
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: peerTLSCfg}}
+	var produced api.ProduceResponse
+	postJSON(t, httpClient, agents[1], "/v1/produce", &api.ProduceRequest{
+		Record: &api.Record{Value: want},
+	}, &produced)
+	testhelper.AssertEqual(t, produce.Offset+2, produced.Offset)
+
+	var consumed api.ConsumeResponse
+	postJSON(t, httpClient, agents[0], "/v1/consume", &api.ConsumeRequest{Offset: produced.Offset}, &consumed)
+	testhelper.AssertEqual(t, want, consumed.Record.Value)
+
+	// a form of another site posts text/plain, which isn't taken
+	rpcAddr, err = agents[0].RPCAddr()
+	testhelper.RequireNoError(t, err)
+	resp, err := httpClient.Post("https://"+rpcAddr+"/v1/produce", "text/plain", strings.NewReader(`{"record":{"value":"Zm9yZ2Vk"}}`))
+	testhelper.RequireNoError(t, err)
+	resp.Body.Close()
+	testhelper.AssertEqual(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	// a reconnecting tail resumes after the Last-Event-ID
+	id, record := tailEvent(t, httpClient, agents[1], fmt.Sprintf("/v1/tail?offset=%d", produce.Offset), produce.Offset+1)
+	testhelper.AssertEqual(t, fmt.Sprint(produced.Offset), id)
+	testhelper.AssertEqual(t, want, record.Value)
+
+	rpcAddr, err = agents[1].RPCAddr()
+	testhelper.RequireNoError(t, err)
+	tailPath := fmt.Sprintf("/v1/tail?offset=%d", produced.Offset)
+	conn2, err := dialWebSocket(agents[1], peerTLSCfg, tailPath, "https://"+rpcAddr)
+	testhelper.RequireNoError(t, err)
+	record = receiveRecord(t, conn2)
+	testhelper.AssertEqual(t, produced.Offset, record.Offset)
+	testhelper.AssertEqual(t, want, record.Value)
+
+	// the committed offsets of the internal topic can't be tailed
+	resp, err = httpClient.Get("https://" + rpcAddr + "/v1/tail?topic=__consumer_offsets")
+	testhelper.RequireNoError(t, err)
+	resp.Body.Close()
+	testhelper.AssertEqual(t, http.StatusBadRequest, resp.StatusCode)
+
+	// a page of another site can't open a WebSocket from the browser
+	_, err = dialWebSocket(agents[1], peerTLSCfg, tailPath, "https://evil.example.com")
+	testhelper.AssertEqual(t, true, err != nil)
+
+	consume, err = leaderClient.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset + 3})
 	testhelper.AssertEqual(t, (*api.ConsumeResponse)(nil), consume)
 	gotErr := status.Code(err)
 	wantErr := status.Code(api.OffsetOutOfRangeError{}.GRPCStatus().Err())
 	testhelper.AssertEqual(t, wantErr, gotErr)
 }
 
+func postJSON(t *testing.T, client *http.Client, agent *agent.Agent, path string, req, res proto.Message) {
+	t.Helper()
+
+	rpcAddr, err := agent.RPCAddr()
+	testhelper.RequireNoError(t, err)
+
+	body, err := protojson.Marshal(req)
+	testhelper.RequireNoError(t, err)
+
+	resp, err := client.Post("https://"+rpcAddr+path, "application/json", bytes.NewReader(body))
+	testhelper.RequireNoError(t, err)
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, http.StatusOK, resp.StatusCode)
+
+	err = protojson.Unmarshal(b, res)
+	testhelper.RequireNoError(t, err)
+}
+
+// tailEvent returns the ID and the record of the first event of the tail.
+func tailEvent(t *testing.T, client *http.Client, agent *agent.Agent, path string, lastEventID uint64) (string, *api.Record) {
+	t.Helper()
+
+	rpcAddr, err := agent.RPCAddr()
+	testhelper.RequireNoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "https://"+rpcAddr+path, nil)
+	testhelper.RequireNoError(t, err)
+	req.Header.Set("Last-Event-ID", fmt.Sprint(lastEventID))
+
+	resp, err := client.Do(req)
+	testhelper.RequireNoError(t, err)
+	defer resp.Body.Close()
+	testhelper.AssertEqual(t, http.StatusOK, resp.StatusCode)
+	testhelper.AssertEqual(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var id string
+	record := &api.Record{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && scanner.Text() != "" {
+		field, value, _ := strings.Cut(scanner.Text(), ": ")
+		switch field {
+		case "id":
+			id = value
+		case "data":
+			err = protojson.Unmarshal([]byte(value), record)
+			testhelper.RequireNoError(t, err)
+		}
+	}
+	testhelper.RequireNoError(t, scanner.Err())
+
+	return id, record
+}
+
+// dialWebSocket opens a WebSocket to the agent as a page of the origin.
+func dialWebSocket(agent *agent.Agent, tlsConfig *tls.Config, path, origin string) (*websocket.Conn, error) {
+	rpcAddr, err := agent.RPCAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := websocket.NewConfig("wss://"+rpcAddr+path, origin)
+	if err != nil {
+		return nil, err
+	}
+	config.TlsConfig = tlsConfig
+
+	return websocket.DialConfig(config)
+}
+
+// receiveRecord returns the record of the next message of the tail, and
+// closes it.
+func receiveRecord(t *testing.T, conn *websocket.Conn) *api.Record {
+	t.Helper()
+	defer conn.Close()
+
+	var msg string
+	err := websocket.Message.Receive(conn, &msg)
+	testhelper.RequireNoError(t, err)
+
+	record := &api.Record{}
+	err = protojson.Unmarshal([]byte(msg), record)
+	testhelper.RequireNoError(t, err)
+
+	return record
+}
+
 func client(t *testing.T, agent *agent.Agent, tlsConfig *tls.Config) api.LogClient {
 	tlsCreds := credentials.NewTLS(tlsConfig)
 	opts := []grpc.DialOption{grpc.WithTransportCredentials(tlsCreds)}
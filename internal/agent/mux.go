@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	tlsRecordHandshake   = 22
+	tlsClientHello       = 1
+	tlsExtensionALPN     = 16
+	tlsRecordHeaderBytes = 5
+)
+
+// tlsWithoutHTTP2 matches the connections starting with a TLS handshake
+// that doesn't offer HTTP/2, the one gRPC runs on.
+func tlsWithoutHTTP2(r io.Reader) bool {
+	header := make([]byte, tlsRecordHeaderBytes)
+	_, err := io.ReadFull(r, header)
+	if err != nil || header[0] != tlsRecordHandshake {
+		return false
+	}
+
+	record := make([]byte, binary.BigEndian.Uint16(header[3:]))
+	_, err = io.ReadFull(r, record)
+	if err != nil {
+		return false
+	}
+
+	protos, ok := clientHelloALPN(record)
+	if !ok {
+		return false
+	}
+
+	for _, proto := range protos {
+		if proto == "h2" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// clientHelloALPN returns the protocols the client hello in the handshake
+// record offers. It fails if the record doesn't hold a whole client hello.
+func clientHelloALPN(b []byte) ([]string, bool) {
+	if len(b) < 4 || b[0] != tlsClientHello {
+		return nil, false
+	}
+	// skip the message type and length, the client version and random
+	b = b[4:]
+	if len(b) < 34 {
+		return nil, false
+	}
+	b = b[34:]
+
+	// the session ID, cipher suites and compression methods
+	for _, lenBytes := range []int{1, 2, 1} {
+		var n int
+		b, n = readLength(b, lenBytes)
+		if n < 0 || len(b) < n {
+			return nil, false
+		}
+		b = b[n:]
+	}
+
+	if len(b) == 0 {
+		// a client hello without extensions
+		return nil, true
+	}
+
+	b, n := readLength(b, 2)
+	if n < 0 || len(b) < n {
+		return nil, false
+	}
+	b = b[:n]
+
+	for len(b) >= 4 {
+		typ := binary.BigEndian.Uint16(b)
+		n := int(binary.BigEndian.Uint16(b[2:]))
+		b = b[4:]
+		if len(b) < n {
+			return nil, false
+		}
+		ext := b[:n]
+		b = b[n:]
+
+		if typ != tlsExtensionALPN {
+			continue
+		}
+
+		var protos []string
+		ext, n = readLength(ext, 2)
+		if n < 0 || len(ext) < n {
+			return nil, false
+		}
+		ext = ext[:n]
+		for len(ext) > 0 {
+			ext, n = readLength(ext, 1)
+			if n < 0 || len(ext) < n {
+				return nil, false
+			}
+			protos = append(protos, string(ext[:n]))
+			ext = ext[n:]
+		}
+
+		return protos, true
+	}
+
+	return nil, true
+}
+
+// readLength reads a big-endian length of size bytes, and returns the rest
+// of b after it. The length is -1 if b is too short.
+func readLength(b []byte, size int) ([]byte, int) {
+	if len(b) < size {
+		return b, -1
+	}
+
+	n := 0
+	for _, c := range b[:size] {
+		n = n<<8 | int(c)
+	}
+
+	return b[size:], n
+}
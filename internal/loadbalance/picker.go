@@ -50,10 +50,12 @@ func (p *Picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 	defer p.mu.RUnlock()
 
 	var result balancer.PickResult
-	if strings.Contains(info.FullMethodName, "Produce") || len(p.followers) == 0 {
-		result.SubConn = p.leader
-	} else if strings.Contains(info.FullMethodName, "Consume") {
+	// only consumes are spread across followers, writes and topic changes
+	// must go through the leader
+	if strings.Contains(info.FullMethodName, "Consume") && len(p.followers) > 0 {
 		result.SubConn = p.nextFollower()
+	} else {
+		result.SubConn = p.leader
 	}
 
 	if result.SubConn == nil {
@@ -0,0 +1,78 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil)
+	})
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	})
+)
+
+func (c Codec) compress(p []byte) ([]byte, error) {
+	switch c {
+	case CodecNone:
+		return p, nil
+	case CodecGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, err := w.Write(p)
+		if err != nil {
+			return nil, err
+		}
+
+		err = w.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	case CodecSnappy:
+		return snappy.Encode(nil, p), nil
+	case CodecZstd:
+		e, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+
+		return e.EncodeAll(p, nil), nil
+	}
+
+	return nil, fmt.Errorf("unknown compression codec %s", c)
+}
+
+func (c Codec) decompress(p []byte) ([]byte, error) {
+	switch c {
+	case CodecNone:
+		return p, nil
+	case CodecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(p))
+		if err != nil {
+			return nil, err
+		}
+
+		return io.ReadAll(r)
+	case CodecSnappy:
+		return snappy.Decode(nil, p)
+	case CodecZstd:
+		d, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+
+		return d.DecodeAll(p, nil)
+	}
+
+	return nil, fmt.Errorf("unknown compression codec %s", c)
+}
@@ -1,6 +1,9 @@
 package log
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/hashicorp/raft"
 )
 
@@ -9,6 +12,50 @@ type Config struct {
 		MaxStoreBytes uint64
 		MaxIndexBytes uint64
 		InitialOffset uint64
+		// TimeIndexIntervalBytes is how many store bytes are appended
+		// between two time index entries.
+		TimeIndexIntervalBytes uint64
+		// Compression is the codec the records appended together are
+		// compressed with as one block.
+		Compression Codec
+	}
+	Sync struct {
+		Policy   SyncPolicy
+		EveryN   uint64
+		Interval time.Duration
+	}
+	Retention struct {
+		MaxAge        time.Duration
+		MaxBytes      uint64
+		CheckInterval time.Duration
+	}
+	Encryption struct {
+		// Keyring encrypts the records of the store and the snapshots of
+		// the log when set.
+		Keyring *Keyring
+	}
+	// Compaction periodically drops the records superseded by a newer
+	// record with the same key.
+	Compaction struct {
+		Enabled  bool
+		Interval time.Duration
+		// txnStatus returns the state of the transaction of a record, so
+		// the records of open and aborted transactions don't supersede the
+		// committed ones. Every record is committed when it's nil.
+		txnStatus func(id uint64) txnStatus
+	}
+	Txn struct {
+		// Timeout is how long a transaction may stay open before the
+		// leader aborts it, so one whose producer died doesn't hold back
+		// the read_committed consumers for good. Zero means a minute.
+		Timeout time.Duration
+	}
+	Topic struct {
+		// Partitions is the number of partitions of the default topic and
+		// of the topics created without a partition count. The leader
+		// creates them through raft, so the value of the node that is the
+		// leader at the time is used.
+		Partitions uint32
 	}
 	Raft struct {
 		raft.Config
@@ -17,3 +64,79 @@ type Config struct {
 		Bootstrap bool
 	}
 }
+
+// SyncPolicy decides when appended records are fsynced to disk.
+type SyncPolicy uint8
+
+const (
+	// SyncNever leaves writing appended records back to disk to the OS.
+	SyncNever SyncPolicy = iota
+	// SyncAlways fsyncs after every append.
+	SyncAlways
+	// SyncEveryN fsyncs once every Sync.EveryN appended records.
+	SyncEveryN
+	// SyncInterval fsyncs every Sync.Interval from a background goroutine.
+	SyncInterval
+)
+
+var syncPolicyNames = map[SyncPolicy]string{
+	SyncNever:    "never",
+	SyncAlways:   "always",
+	SyncEveryN:   "every-n",
+	SyncInterval: "interval",
+}
+
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	for policy, name := range syncPolicyNames {
+		if name == s {
+			return policy, nil
+		}
+	}
+
+	return SyncNever, fmt.Errorf("unknown sync policy %q", s)
+}
+
+func (p SyncPolicy) String() string {
+	name, ok := syncPolicyNames[p]
+	if !ok {
+		return fmt.Sprintf("SyncPolicy(%d)", p)
+	}
+
+	return name
+}
+
+// Codec is the compression codec of a block of records in the store.
+type Codec uint8
+
+const (
+	CodecNone Codec = iota
+	CodecGzip
+	CodecSnappy
+	CodecZstd
+)
+
+var codecNames = map[Codec]string{
+	CodecNone:   "none",
+	CodecGzip:   "gzip",
+	CodecSnappy: "snappy",
+	CodecZstd:   "zstd",
+}
+
+func ParseCodec(s string) (Codec, error) {
+	for codec, name := range codecNames {
+		if name == s {
+			return codec, nil
+		}
+	}
+
+	return CodecNone, fmt.Errorf("unknown compression codec %q", s)
+}
+
+func (c Codec) String() string {
+	name, ok := codecNames[c]
+	if !ok {
+		return fmt.Sprintf("Codec(%d)", c)
+	}
+
+	return name
+}
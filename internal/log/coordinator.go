@@ -0,0 +1,273 @@
+package log
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+)
+
+const (
+	// memberCheckInterval is how often the leader looks for the members
+	// whose session timed out.
+	memberCheckInterval = 100 * time.Millisecond
+	// txnCheckInterval is how often the leader looks for the transactions
+	// that timed out, and every node for the aborted ones to forget.
+	txnCheckInterval = 100 * time.Millisecond
+	// defaultTxnTimeout aborts the transactions left open for a minute.
+	defaultTxnTimeout = time.Minute
+)
+
+type memberKey struct {
+	group string
+	id    string
+}
+
+// coordinator tracks the heartbeats of the members of the consumer groups,
+// and when the open transactions time out. Neither is replicated, so only
+// the leader knows when a member was last seen, and a new leader gives every
+// member a full session and every transaction a full timeout.
+type coordinator struct {
+	mu           sync.Mutex
+	deadlines    map[memberKey]time.Time
+	txnDeadlines map[uint64]time.Time
+}
+
+// JoinGroup adds the consumer to the group and returns the partitions
+// assigned to it. A consumer joining for the first time gets a new member ID.
+func (l *Distributed) JoinGroup(req *api.JoinGroupRequest) (*api.JoinGroupResponse, error) {
+	err := validateGroup(req.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.MemberId == "" {
+		b := make([]byte, 8)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, fmt.Errorf("generate member ID: %w", err)
+		}
+		req.MemberId = hex.EncodeToString(b)
+	}
+
+	res, err := l.apply(JoinGroupRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+
+	l.touch(req.Group, req.MemberId)
+
+	return res.(*api.JoinGroupResponse), nil
+}
+
+// Heartbeat keeps the member in the group consuming the topic. It fails once
+// the group moved to another generation, and the member must join again.
+func (l *Distributed) Heartbeat(group, topic, memberID string, generation uint64) error {
+	if l.raft.State() != raft.Leader {
+		return l.notLeader()
+	}
+
+	err := l.checkGroupTopic(group, topic, memberID)
+	if err != nil {
+		return err
+	}
+
+	err = l.groups.check(group, memberID, generation)
+	if err != nil {
+		return err
+	}
+
+	l.touch(group, memberID)
+
+	return nil
+}
+
+func (l *Distributed) LeaveGroup(group, topic, memberID string) error {
+	err := l.checkGroupTopic(group, topic, memberID)
+	if err != nil {
+		return err
+	}
+
+	return l.leaveGroup(group, memberID)
+}
+
+func (l *Distributed) leaveGroup(group, memberID string) error {
+	_, err := l.apply(LeaveGroupRequestType, &api.LeaveGroupRequest{
+		Group:    group,
+		MemberId: memberID,
+	})
+	if err != nil {
+		return err
+	}
+
+	l.coordinator.mu.Lock()
+	delete(l.coordinator.deadlines, memberKey{group, memberID})
+	l.coordinator.mu.Unlock()
+
+	return nil
+}
+
+// expireMembers removes the members that didn't heartbeat within their
+// session timeout from their group, while the node is the leader.
+func (l *Distributed) expireMembers() {
+	ticker := time.NewTicker(memberCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.closed:
+			return
+		case <-ticker.C:
+		}
+
+		if l.raft.State() != raft.Leader {
+			l.coordinator.mu.Lock()
+			clear(l.coordinator.deadlines)
+			l.coordinator.mu.Unlock()
+			continue
+		}
+
+		now := time.Now()
+		var expired []memberKey
+		l.coordinator.mu.Lock()
+		for _, m := range l.groups.members() {
+			key := memberKey{m.group, m.id}
+			deadline, ok := l.coordinator.deadlines[key]
+			if !ok {
+				l.coordinator.deadlines[key] = now.Add(m.sessionTimeout)
+				continue
+			}
+
+			if now.After(deadline) {
+				expired = append(expired, key)
+			}
+		}
+		l.coordinator.mu.Unlock()
+
+		for _, key := range expired {
+			err := l.leaveGroup(key.group, key.id)
+			if err != nil {
+				zap.L().Named("coordinator").Error(
+					"failed to remove expired member",
+					zap.Error(err),
+					zap.String("group", key.group),
+					zap.String("member", key.id),
+				)
+			}
+		}
+	}
+}
+
+// expireTxns aborts the transactions still open after the transaction
+// timeout while the node is the leader. Every node forgets the aborted
+// transactions whose records it no longer has.
+func (l *Distributed) expireTxns() {
+	timeout := l.cfg.Txn.Timeout
+	if timeout == 0 {
+		timeout = defaultTxnTimeout
+	}
+
+	ticker := time.NewTicker(txnCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.closed:
+			return
+		case <-ticker.C:
+		}
+
+		l.txns.prune(l.lowestOffset)
+
+		if l.raft.State() != raft.Leader {
+			l.coordinator.mu.Lock()
+			clear(l.coordinator.txnDeadlines)
+			l.coordinator.mu.Unlock()
+			continue
+		}
+
+		now := time.Now()
+		var expired []uint64
+		l.coordinator.mu.Lock()
+		open := make(map[uint64]bool)
+		for _, id := range l.txns.openIDs() {
+			open[id] = true
+			deadline, ok := l.coordinator.txnDeadlines[id]
+			if !ok {
+				l.coordinator.txnDeadlines[id] = now.Add(timeout)
+				continue
+			}
+
+			if now.After(deadline) {
+				expired = append(expired, id)
+			}
+		}
+		for id := range l.coordinator.txnDeadlines {
+			if !open[id] {
+				delete(l.coordinator.txnDeadlines, id)
+			}
+		}
+		l.coordinator.mu.Unlock()
+
+		for _, id := range expired {
+			producerID, epoch, ok := l.txns.owner(id)
+			if !ok {
+				continue
+			}
+
+			err := l.AbortTxn(&api.AbortTxnRequest{
+				TxnId:         id,
+				ProducerId:    producerID,
+				ProducerEpoch: epoch,
+			})
+			if err != nil && !errors.As(err, &api.TxnNotOpenError{}) {
+				zap.L().Named("coordinator").Error(
+					"failed to abort timed out transaction",
+					zap.Error(err),
+					zap.Uint64("txn", id),
+				)
+			}
+		}
+	}
+}
+
+// lowestOffset returns the lowest offset of the partition, and false if it
+// doesn't exist.
+func (l *Distributed) lowestOffset(topic string, partition uint32) (uint64, bool) {
+	offset, err := l.LowestOffset(topic, partition)
+	if err != nil {
+		return 0, false
+	}
+
+	return offset, true
+}
+
+// checkGroupTopic returns an error unless the group consumes the topic, so
+// the member is only known to the callers authorized for the topic.
+func (l *Distributed) checkGroupTopic(group, topic, memberID string) error {
+	groupTopic, ok := l.groups.topic(group)
+	if !ok || groupTopic != topicOrDefault(topic) {
+		return api.UnknownMemberError{Group: group, MemberID: memberID}
+	}
+
+	return nil
+}
+
+// touch starts a new session for the member.
+func (l *Distributed) touch(group, memberID string) {
+	l.coordinator.mu.Lock()
+	defer l.coordinator.mu.Unlock()
+
+	for _, m := range l.groups.members() {
+		if m.group == group && m.id == memberID {
+			l.coordinator.deadlines[memberKey{group, memberID}] = time.Now().Add(m.sessionTimeout)
+		}
+	}
+}
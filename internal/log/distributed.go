@@ -2,27 +2,45 @@ package log
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/hashicorp/raft"
 	raftboltdb "github.com/hashicorp/raft-boltdb"
+	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
 
 	api "github.com/huytran2000-hcmus/proglog/api/v1"
 )
 
 type Distributed struct {
-	cfg  Config
-	log  *Log
-	raft *raft.Raft
+	cfg         Config
+	topics      *Topics
+	groups      *groups
+	producers   *producers
+	txns        *txns
+	coordinator coordinator
+	raft        *raft.Raft
+	logStore    *logStore
+	closed      chan struct{}
 }
 
 func NewDistributed(dataDir string, config Config) (*Distributed, error) {
 	l := &Distributed{
-		cfg: config,
+		cfg:       config,
+		groups:    newGroups(),
+		producers: newProducers(),
+		txns:      newTxns(),
+		coordinator: coordinator{
+			deadlines:    make(map[memberKey]time.Time),
+			txnDeadlines: make(map[uint64]time.Time),
+		},
+		closed: make(chan struct{}),
 	}
 
 	err := l.setupLog(dataDir)
@@ -35,14 +53,32 @@ func NewDistributed(dataDir string, config Config) (*Distributed, error) {
 		return nil, fmt.Errorf("set up raft: %w", err)
 	}
 
+	go l.expireMembers()
+	go l.expireTxns()
+	go l.createDefaultPartitions()
+
 	return l, nil
 }
 
-func (l *Distributed) Append(record *api.Record) (uint64, error) {
-	res, err := l.apply(
-		AppendRequestType,
-		&api.ProduceRequest{Record: record},
-	)
+// Append appends the record of the request to its partition. A request of
+// an idempotent producer that was already appended returns the offset of
+// the first append instead. With LEADER acks it returns zero once the
+// leader accepted the record.
+func (l *Distributed) Append(req *api.ProduceRequest) (uint64, error) {
+	if req.Record == nil {
+		return 0, errNoRecord
+	}
+
+	// stamp the record on the leader so every replica stores the same time,
+	// whatever time the client set
+	req.Record.Timestamp = time.Now().UnixNano()
+
+	if req.Acks == api.Acks_LEADER {
+		_, err := l.enqueue(AppendRequestType, req)
+		return 0, err
+	}
+
+	res, err := l.apply(AppendRequestType, req)
 	if err != nil {
 		return 0, err
 	}
@@ -50,8 +86,362 @@ func (l *Distributed) Append(record *api.Record) (uint64, error) {
 	return res.(*api.ProduceResponse).Offset, nil
 }
 
-func (l *Distributed) Read(offset uint64) (*api.Record, error) {
-	return l.log.Read(offset)
+// AppendBatch appends the records of the request to their partition with a
+// single raft apply and returns the offset of the first one. The records get
+// contiguous offsets.
+func (l *Distributed) AppendBatch(req *api.ProduceBatchRequest) (uint64, error) {
+	if slices.Contains(req.Records, nil) {
+		return 0, errNoRecord
+	}
+
+	now := time.Now().UnixNano()
+	for _, record := range req.Records {
+		record.Timestamp = now
+	}
+
+	if req.Acks == api.Acks_LEADER {
+		_, err := l.enqueue(AppendBatchRequestType, req)
+		return 0, err
+	}
+
+	res, err := l.apply(AppendBatchRequestType, req)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.(*api.ProduceBatchResponse).FirstOffset, nil
+}
+
+// BeginTxn opens a transaction of the producer of the request and returns
+// its ID. The records produced with the ID are hidden from read_committed
+// consumers until it's committed, and for good if it's aborted. Only the
+// producer, at the same epoch, can produce in the transaction and end it.
+func (l *Distributed) BeginTxn(req *api.BeginTxnRequest) (uint64, error) {
+	res, err := l.apply(BeginTxnRequestType, req)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.(*api.BeginTxnResponse).TxnId, nil
+}
+
+func (l *Distributed) CommitTxn(req *api.CommitTxnRequest) error {
+	_, err := l.apply(CommitTxnRequestType, req)
+	return err
+}
+
+func (l *Distributed) AbortTxn(req *api.AbortTxnRequest) error {
+	_, err := l.apply(AbortTxnRequestType, req)
+	return err
+}
+
+// InitProducer hands out a new producer ID, or fences the earlier epochs of
+// the producer ID in the request.
+func (l *Distributed) InitProducer(req *api.InitProducerRequest) (*api.InitProducerResponse, error) {
+	res, err := l.apply(InitProducerRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*api.InitProducerResponse), nil
+}
+
+func (l *Distributed) Read(topic string, partition uint32, offset uint64) (*api.Record, error) {
+	return l.topics.Read(topic, partition, offset)
+}
+
+func (l *Distributed) Wait(ctx context.Context, topic string, partition uint32, offset uint64) error {
+	return l.topics.Wait(ctx, topic, partition, offset)
+}
+
+// VerifyRead returns an error unless the node can serve reads of the
+// consistency. A linearizable read waits until the leader confirmed it's
+// still the leader and applied every record committed before the read.
+func (l *Distributed) VerifyRead(consistency api.Consistency) error {
+	if consistency == api.Consistency_STALE {
+		return nil
+	}
+
+	if l.raft.State() != raft.Leader {
+		return l.notLeader()
+	}
+
+	if consistency != api.Consistency_LINEARIZABLE {
+		return nil
+	}
+
+	// the commit index is taken before leadership is verified, so it covers
+	// every record committed before the read started
+	index := l.raft.CommitIndex()
+	err := l.raft.VerifyLeader().Error()
+	if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+		return l.notLeader()
+	}
+	if err != nil {
+		return fmt.Errorf("verify leadership: %w", err)
+	}
+
+	if l.raft.AppliedIndex() < index {
+		err = l.raft.Barrier(10 * time.Second).Error()
+		if err != nil {
+			return fmt.Errorf("wait for committed records to be applied: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// notLeader returns the error for the requests only the leader serves.
+func (l *Distributed) notLeader() error {
+	addr, _ := l.raft.LeaderWithID()
+	return api.NotLeaderError{Leader: string(addr)}
+}
+
+// ReadCommitted returns the first record at or after offset that
+// read_committed consumers see. The records of aborted transactions are
+// skipped, and no record is read from the first one of a transaction still
+// open on the partition on.
+func (l *Distributed) ReadCommitted(topic string, partition uint32, offset uint64) (*api.Record, error) {
+	record, _, _, err := l.scanCommitted(topic, partition, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if record == nil {
+		return nil, api.OffsetOutOfRangeError{Offset: offset}
+	}
+
+	return record, nil
+}
+
+// WaitCommitted blocks until ReadCommitted has a record at or after offset
+// to return, or ctx is done.
+func (l *Distributed) WaitCommitted(ctx context.Context, topic string, partition uint32, offset uint64) error {
+	for {
+		ended := l.txns.waitEnded()
+		record, next, open, err := l.scanCommitted(topic, partition, offset)
+		if err != nil {
+			return err
+		}
+
+		if record != nil {
+			return nil
+		}
+
+		if !open {
+			err = l.topics.Wait(ctx, topic, partition, next)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-ended:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.closed:
+			return ErrClosed
+		}
+	}
+}
+
+// scanCommitted reads from offset until it finds a record read_committed
+// consumers see. Without one, it returns the offset it stopped at, and
+// whether an open transaction stopped it rather than the end of the
+// partition.
+func (l *Distributed) scanCommitted(topic string, partition uint32, offset uint64) (*api.Record, uint64, bool, error) {
+	for {
+		record, err := l.topics.Read(topic, partition, offset)
+		var rangeErr api.OffsetOutOfRangeError
+		if errors.As(err, &rangeErr) && rangeErr.Offset >= rangeErr.Lowest {
+			return nil, offset, false, nil
+		}
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		// the stable offset is taken after the read, so a transaction
+		// that appended before the record is known by then
+		stable, ok := l.txns.stableOffset(topic, partition)
+		if ok && record.Offset >= stable {
+			return nil, stable, true, nil
+		}
+
+		if l.txns.visible(record) {
+			return record, 0, false, nil
+		}
+
+		if l.txns.open(record.TxnId) {
+			return nil, record.Offset, true, nil
+		}
+
+		// the record belongs to an aborted transaction
+		offset = record.Offset + 1
+	}
+}
+
+func (l *Distributed) OffsetForTime(topic string, partition uint32, t time.Time) (uint64, error) {
+	return l.topics.OffsetForTime(topic, partition, t)
+}
+
+func (l *Distributed) LowestOffset(topic string, partition uint32) (uint64, error) {
+	log, err := l.topics.Log(topic, partition)
+	if err != nil {
+		return 0, err
+	}
+
+	return log.LowestOffset()
+}
+
+func (l *Distributed) HighestOffset(topic string, partition uint32) (uint64, error) {
+	log, err := l.topics.Log(topic, partition)
+	if err != nil {
+		return 0, err
+	}
+
+	return log.HighestOffset()
+}
+
+// GetOffsets returns the range of offsets of the partition and the raft
+// indexes of the node, as this node holds them.
+func (l *Distributed) GetOffsets(topic string, partition uint32) (*api.GetOffsetsResponse, error) {
+	log, err := l.topics.Log(topic, partition)
+	if err != nil {
+		return nil, err
+	}
+
+	lowest, err := log.LowestOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	highest, err := log.HighestOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := log.NextOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.GetOffsetsResponse{
+		LowestOffset:  lowest,
+		HighestOffset: highest,
+		NextOffset:    next,
+		CommitIndex:   l.raft.CommitIndex(),
+		AppliedIndex:  l.raft.AppliedIndex(),
+		Segments:      uint32(log.Segments()),
+	}, nil
+}
+
+// Partitions returns the number of partitions of the topic. The partitions
+// of every topic are replicated through the same raft log, so they scale the
+// consumers of a topic but not the throughput of the appends.
+func (l *Distributed) Partitions(topic string) (uint32, error) {
+	return l.topics.Partitions(topic)
+}
+
+// CreateTopic creates the topic on every replica. The name is checked before
+// it is applied so invalid names don't reach the raft log. A topic created
+// without a partition count gets the node's default.
+func (l *Distributed) CreateTopic(name string, partitions uint32) error {
+	err := validateTopic(name)
+	if err != nil {
+		return err
+	}
+
+	if name == DefaultTopic {
+		return api.TopicExistsError{Topic: name}
+	}
+
+	// the count is picked here so every replica creates the same partitions
+	if partitions == 0 {
+		partitions = l.topics.Config.Topic.Partitions
+	}
+
+	_, err = l.apply(CreateTopicRequestType, &api.CreateTopicRequest{
+		Name:       name,
+		Partitions: partitions,
+	})
+
+	return err
+}
+
+// defaultTopicCheckInterval is how often a node checks whether the default
+// topic has the configured partitions yet.
+const defaultTopicCheckInterval = 100 * time.Millisecond
+
+// createDefaultPartitions adds the configured partitions the default topic
+// lacks through raft, once the node is the leader, so every replica has the
+// same partitions. It returns when the default topic has them all.
+func (l *Distributed) createDefaultPartitions() {
+	want := l.topics.Config.Topic.Partitions
+
+	ticker := time.NewTicker(defaultTopicCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		partitions, err := l.topics.Partitions(DefaultTopic)
+		if err == nil && partitions >= want {
+			return
+		}
+
+		select {
+		case <-l.closed:
+			return
+		case <-ticker.C:
+		}
+
+		if l.raft.State() != raft.Leader {
+			continue
+		}
+
+		_, err = l.apply(CreateTopicRequestType, &api.CreateTopicRequest{
+			Name:       DefaultTopic,
+			Partitions: want,
+		})
+		if err != nil {
+			zap.L().Named("distributed").Error(
+				"failed to create the partitions of the default topic",
+				zap.Error(err),
+				zap.Uint32("partitions", want),
+			)
+		}
+	}
+}
+
+func (l *Distributed) DeleteTopic(name string) error {
+	if topicOrDefault(name) == DefaultTopic {
+		return api.InvalidTopicError{Topic: DefaultTopic, Reason: "the default topic can't be deleted"}
+	}
+
+	_, err := l.apply(DeleteTopicRequestType, &api.DeleteTopicRequest{Name: name})
+
+	return err
+}
+
+// CommitOffset stores the offset as the next offset the group consumes from
+// the partition, on every replica. A commit naming a member is refused
+// unless the partition is assigned to the member for the generation.
+func (l *Distributed) CommitOffset(req *api.CommitOffsetRequest) error {
+	err := validateGroup(req.Group)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.apply(CommitOffsetRequestType, req)
+
+	return err
+}
+
+func (l *Distributed) CommittedOffset(group, topic string, partition uint32) (uint64, error) {
+	return l.topics.CommittedOffset(group, topic, partition)
+}
+
+func (l *Distributed) ListTopics() ([]string, error) {
+	return l.topics.ListTopics()
 }
 
 func (l *Distributed) Join(id, addr string) error {
@@ -93,13 +483,11 @@ func (l *Distributed) Leave(id string) error {
 }
 
 func (l *Distributed) setupLog(dataDir string) error {
-	logDir := filepath.Join(dataDir, "log")
-	err := os.MkdirAll(logDir, 0755)
-	if err != nil {
-		return fmt.Errorf("create log data dir: %w", err)
-	}
+	c := l.cfg
+	c.Compaction.txnStatus = l.txns.status
 
-	l.log, err = New(logDir, l.cfg)
+	var err error
+	l.topics, err = NewTopics(dataDir, c)
 
 	return err
 }
@@ -142,6 +530,8 @@ func (l *Distributed) WaitForLeader(timeout time.Duration) error {
 }
 
 func (l *Distributed) Close() error {
+	close(l.closed)
+
 	failed := l.raft.Shutdown()
 
 	err := failed.Error()
@@ -149,11 +539,16 @@ func (l *Distributed) Close() error {
 		return err
 	}
 
-	return l.log.Close()
+	err = l.logStore.Close()
+	if err != nil {
+		return fmt.Errorf("close raft's log store: %w", err)
+	}
+
+	return l.topics.Close()
 }
 
 func (l *Distributed) setupRaft(dataDir string) error {
-	fsm := &fsm{log: l.log}
+	fsm := &fsm{topics: l.topics, groups: l.groups, producers: l.producers, txns: l.txns}
 
 	logDir := filepath.Join(dataDir, "raft", "log")
 	err := os.MkdirAll(logDir, 0755)
@@ -162,7 +557,12 @@ func (l *Distributed) setupRaft(dataDir string) error {
 	}
 	logConfig := l.cfg
 	logConfig.Segment.InitialOffset = 1
-	logStore, err := newLogStore(logDir, logConfig)
+	// raft truncates its own log once the entries are in a snapshot, and its
+	// entries have no keys to compact by
+	logConfig.Retention.MaxAge = 0
+	logConfig.Retention.MaxBytes = 0
+	logConfig.Compaction.Enabled = false
+	l.logStore, err = newLogStore(logDir, logConfig)
 	if err != nil {
 		return fmt.Errorf("create raft's log store: %w", err)
 	}
@@ -211,7 +611,7 @@ func (l *Distributed) setupRaft(dataDir string) error {
 	l.raft, err = raft.NewRaft(
 		config,
 		fsm,
-		logStore,
+		l.logStore,
 		stableStore,
 		snapshotStore,
 		transport,
@@ -220,7 +620,7 @@ func (l *Distributed) setupRaft(dataDir string) error {
 		return fmt.Errorf("create raft: %w", err)
 	}
 
-	hasState, err := raft.HasExistingState(logStore, stableStore, snapshotStore)
+	hasState, err := raft.HasExistingState(l.logStore, stableStore, snapshotStore)
 	if err != nil {
 		return fmt.Errorf("check if has existing state: %w", err)
 	}
@@ -241,6 +641,38 @@ func (l *Distributed) setupRaft(dataDir string) error {
 }
 
 func (l *Distributed) apply(reqType RequestType, req proto.Message) (interface{}, error) {
+	future, err := l.enqueue(reqType, req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = future.Error()
+	if errors.Is(err, raft.ErrNotLeader) {
+		return nil, l.notLeader()
+	}
+	// the request is in the raft log and the next leader may commit it
+	if errors.Is(err, raft.ErrLeadershipLost) {
+		return nil, api.LeadershipLostError{}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := future.Response()
+	if err, ok := res.(error); ok {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// enqueue hands the request to raft without waiting for it to be committed
+// and applied.
+func (l *Distributed) enqueue(reqType RequestType, req proto.Message) (raft.ApplyFuture, error) {
+	if l.raft.State() != raft.Leader {
+		return nil, l.notLeader()
+	}
+
 	var buf bytes.Buffer
 	_, err := buf.Write([]byte{byte(reqType)})
 	if err != nil {
@@ -258,15 +690,5 @@ func (l *Distributed) apply(reqType RequestType, req proto.Message) (interface{}
 	}
 
 	timeout := 10 * time.Second
-	future := l.raft.Apply(buf.Bytes(), timeout)
-	if future.Error() != nil {
-		return nil, future.Error()
-	}
-
-	res := future.Response()
-	if err, ok := res.(error); ok {
-		return nil, err
-	}
-
-	return res, nil
+	return l.raft.Apply(buf.Bytes(), timeout), nil
 }
@@ -49,6 +49,8 @@ func TestMultipleNode(t *testing.T) {
 
 		if i == 0 {
 			config.Raft.Bootstrap = true
+			// the followers get the leader's partitions
+			config.Topic.Partitions = 3
 		}
 
 		l, err := log.NewDistributed(dataDir, config)
@@ -69,30 +71,99 @@ func TestMultipleNode(t *testing.T) {
 		logs = append(logs, l)
 	}
 
+	err := logs[0].CreateTopic("orders", 0)
+	testhelper.RequireNoError(t, err)
+	require.Eventually(t, func() bool {
+		for j := 0; j < n; j++ {
+			for _, topic := range []string{log.DefaultTopic, "orders"} {
+				partitions, err := logs[j].Partitions(topic)
+				if err != nil || partitions != 3 {
+					return false
+				}
+			}
+		}
+
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// the leader stamps the records over the time the client set
 	records := []*api.Record{
 		{Value: []byte("first")},
-		{Value: []byte("second")},
+		{Value: []byte("second"), Timestamp: 1},
 	}
 
 	for _, record := range records {
-		off, err := logs[0].Append(record)
+		off, err := logs[0].Append(&api.ProduceRequest{Record: record})
 		testhelper.RequireNoError(t, err)
 		require.Eventually(t, func() bool {
 			for j := 0; j < n; j++ {
-				got, err := logs[j].Read(off)
+				got, err := logs[j].Read("", 0, off)
 				if err != nil {
 					return false
 				}
 
 				record.Offset = off
-				if !reflect.DeepEqual(got.Value, record.Value) {
+				if !reflect.DeepEqual(got.Value, record.Value) || got.Timestamp != record.Timestamp {
 					return false
 				}
 			}
 
 			return true
 		}, 5*time.Second, 50*time.Millisecond)
+		testhelper.AssertEqual(t, true, record.Timestamp > 1)
+	}
+
+	_, err = logs[0].Append(&api.ProduceRequest{TxnId: 1})
+	require.Error(t, err)
+	_, err = logs[0].AppendBatch(&api.ProduceBatchRequest{Records: []*api.Record{{}, nil}})
+	require.Error(t, err)
+
+	batch := []*api.Record{
+		{Value: []byte("third")},
+		{Value: []byte("fourth")},
+		{Value: []byte("fifth")},
+	}
+	first, err := logs[0].AppendBatch(&api.ProduceBatchRequest{Records: batch})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(len(records)), first)
+	require.Eventually(t, func() bool {
+		for j := 0; j < n; j++ {
+			for i, record := range batch {
+				got, err := logs[j].Read("", 0, first+uint64(i))
+				if err != nil || !reflect.DeepEqual(got.Value, record.Value) {
+					return false
+				}
+			}
+		}
+
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+
+	err = logs[0].CommitOffset(&api.CommitOffsetRequest{Group: "billing", Offset: first})
+	testhelper.RequireNoError(t, err)
+	require.Eventually(t, func() bool {
+		for j := 0; j < n; j++ {
+			offset, err := logs[j].CommittedOffset("billing", "", 0)
+			if err != nil || offset != first {
+				return false
+			}
+		}
+
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// every replica stamps the committed offset with the same time
+	var timestamps []int64
+	for j := 0; j < n; j++ {
+		off, err := logs[j].HighestOffset(log.OffsetsTopic, 0)
+		testhelper.RequireNoError(t, err)
+		got, err := logs[j].Read(log.OffsetsTopic, 0, off)
+		testhelper.RequireNoError(t, err)
+		timestamps = append(timestamps, got.Timestamp)
 	}
+	testhelper.AssertEqual(t, true, timestamps[0] != 0)
+	testhelper.AssertEqual(t, timestamps[0], timestamps[1])
+	testhelper.AssertEqual(t, timestamps[0], timestamps[2])
 
 	servers, err := logs[0].GetServers()
 	testhelper.RequireNoError(t, err)
@@ -101,6 +172,15 @@ func TestMultipleNode(t *testing.T) {
 	testhelper.AssertEqual(t, false, servers[1].IsLeader)
 	testhelper.AssertEqual(t, false, servers[2].IsLeader)
 
+	err = logs[0].VerifyRead(api.Consistency_LINEARIZABLE)
+	testhelper.AssertNoError(t, err)
+
+	err = logs[1].VerifyRead(api.Consistency_STALE)
+	testhelper.AssertNoError(t, err)
+
+	err = logs[1].VerifyRead(api.Consistency_FROM_LEADER)
+	testhelper.AssertError(t, api.NotLeaderError{Leader: servers[0].RpcAddr}, err)
+
 	err = logs[0].Leave("1")
 	testhelper.AssertNoError(t, err)
 
@@ -112,20 +192,119 @@ func TestMultipleNode(t *testing.T) {
 	testhelper.AssertEqual(t, true, servers[0].IsLeader)
 	testhelper.AssertEqual(t, false, servers[1].IsLeader)
 
-	off, err := logs[0].Append(&api.Record{
-		Value: []byte("third"),
-	})
+	off, err := logs[0].Append(&api.ProduceRequest{Record: &api.Record{
+		Value: []byte("sixth"),
+	}})
 	testhelper.AssertNoError(t, err)
 
 	time.Sleep(50 * time.Millisecond)
 
-	_, err = logs[1].Read(off)
+	_, err = logs[1].Read("", 0, off)
 	if !errors.As(err, &api.OffsetOutOfRangeError{}) {
 		t.Errorf("expect OffsetOutOfRangeError, got %v", err)
 	}
 
-	record, err := logs[2].Read(off)
+	record, err := logs[2].Read("", 0, off)
 	testhelper.RequireNoError(t, err)
 	testhelper.AssertEqual(t, off, record.Offset)
-	testhelper.AssertEqual(t, []byte("third"), record.Value)
+	testhelper.AssertEqual(t, []byte("sixth"), record.Value)
+}
+
+func TestTxnTimeout(t *testing.T) {
+	dataDir, err := os.MkdirTemp(os.TempDir(), "distributed-log-txn-test")
+	testhelper.RequireNoError(t, err)
+	defer os.RemoveAll(dataDir)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	testhelper.RequireNoError(t, err)
+
+	var config log.Config
+	config.Raft.Stream = log.NewStreamLayer(ln, nil, nil)
+	config.Raft.LocalID = raft.ServerID("0")
+	config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+	config.Raft.ElectionTimeout = 50 * time.Millisecond
+	config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.Raft.CommitTimeout = 5 * time.Millisecond
+	config.Raft.BindAddr = ln.Addr().String()
+	config.Raft.Bootstrap = true
+	config.Txn.Timeout = 200 * time.Millisecond
+
+	l, err := log.NewDistributed(dataDir, config)
+	testhelper.RequireNoError(t, err)
+	defer l.Close()
+
+	err = l.WaitForLeader(10 * time.Second)
+	testhelper.RequireNoError(t, err)
+
+	producer, err := l.InitProducer(&api.InitProducerRequest{})
+	testhelper.RequireNoError(t, err)
+
+	id, err := l.BeginTxn(&api.BeginTxnRequest{ProducerId: producer.ProducerId})
+	testhelper.RequireNoError(t, err)
+
+	_, err = l.Append(&api.ProduceRequest{
+		Record:     &api.Record{Value: []byte("abandoned")},
+		ProducerId: producer.ProducerId,
+		TxnId:      id,
+	})
+	testhelper.RequireNoError(t, err)
+
+	committed, err := l.Append(&api.ProduceRequest{Record: &api.Record{Value: []byte("committed")}})
+	testhelper.RequireNoError(t, err)
+
+	// the abandoned transaction holds back read_committed consumers until
+	// the leader aborts it
+	require.Eventually(t, func() bool {
+		record, err := l.ReadCommitted("", 0, 0)
+		return err == nil && record.Offset == committed
+	}, 5*time.Second, 50*time.Millisecond)
+
+	err = l.CommitTxn(&api.CommitTxnRequest{TxnId: id, ProducerId: producer.ProducerId})
+	testhelper.AssertError(t, api.TxnNotOpenError{TxnID: id}, err)
+}
+
+func TestLeadershipLost(t *testing.T) {
+	var logs []*log.Distributed
+	for i := 0; i < 2; i++ {
+		dataDir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("distributed-log-lost-test-%d", i))
+		testhelper.RequireNoError(t, err)
+		defer os.RemoveAll(dataDir)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		testhelper.RequireNoError(t, err)
+
+		var config log.Config
+		config.Raft.Stream = log.NewStreamLayer(ln, nil, nil)
+		config.Raft.LocalID = raft.ServerID(fmt.Sprintf("%d", i))
+		config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+		config.Raft.ElectionTimeout = 50 * time.Millisecond
+		config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+		config.Raft.CommitTimeout = 5 * time.Millisecond
+		config.Raft.BindAddr = ln.Addr().String()
+		config.Raft.Bootstrap = i == 0
+
+		l, err := log.NewDistributed(dataDir, config)
+		testhelper.RequireNoError(t, err)
+
+		if i == 0 {
+			defer l.Close()
+			err = l.WaitForLeader(10 * time.Second)
+			testhelper.RequireNoError(t, err)
+		} else {
+			err = logs[0].Join("1", ln.Addr().String())
+			testhelper.RequireNoError(t, err)
+		}
+		logs = append(logs, l)
+	}
+
+	_, err := logs[0].Append(&api.ProduceRequest{Record: &api.Record{Value: []byte("first")}})
+	testhelper.RequireNoError(t, err)
+
+	// without its follower the leader can't commit the append, and steps
+	// down once its lease runs out
+	err = logs[1].Close()
+	testhelper.RequireNoError(t, err)
+
+	_, err = logs[0].Append(&api.ProduceRequest{Record: &api.Record{Value: []byte("second")}})
+	testhelper.AssertError(t, api.LeadershipLostError{}, err)
 }
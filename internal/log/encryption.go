@@ -0,0 +1,271 @@
+package log
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	keyIDWidth = 4
+	nonceWidth = 12
+)
+
+var errNoKeyring = errors.New("data is encrypted but no encryption key is configured")
+
+// Keyring holds the AES-GCM keys records are encrypted with. New records are
+// encrypted with the active key, the other keys are kept to decrypt what was
+// written before the active key was rotated.
+type Keyring struct {
+	active uint32
+	aeads  map[uint32]cipher.AEAD
+}
+
+// keyFile is the JSON layout of a key file. Keys are base64 encoded and must
+// be 16, 24 or 32 bytes long.
+type keyFile struct {
+	Active uint32            `json:"active"`
+	Keys   map[uint32][]byte `json:"keys"`
+}
+
+func LoadKeyring(path string) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+
+	var f keyFile
+	err = json.Unmarshal(b, &f)
+	if err != nil {
+		return nil, fmt.Errorf("parse key file: %w", err)
+	}
+
+	return NewKeyring(f.Active, f.Keys)
+}
+
+func NewKeyring(active uint32, keys map[uint32][]byte) (*Keyring, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active key %d is missing", active)
+	}
+
+	k := &Keyring{
+		active: active,
+		aeads:  make(map[uint32]cipher.AEAD, len(keys)),
+	}
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("create cipher for key %d: %w", id, err)
+		}
+
+		k.aeads[id], err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("create gcm for key %d: %w", id, err)
+		}
+	}
+
+	return k, nil
+}
+
+// seal encrypts p with the active key. The result starts with the key ID
+// and the nonce.
+func (k *Keyring) seal(p, additionalData []byte) ([]byte, error) {
+	b := make([]byte, keyIDWidth+nonceWidth, keyIDWidth+nonceWidth+len(p)+16)
+	enc.PutUint32(b, k.active)
+
+	_, err := rand.Read(b[keyIDWidth:])
+	if err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	return k.aeads[k.active].Seal(b, b[keyIDWidth:], p, additionalData), nil
+}
+
+// open decrypts what seal encrypted, with the key it names.
+func (k *Keyring) open(b, additionalData []byte) ([]byte, error) {
+	if k == nil {
+		return nil, errNoKeyring
+	}
+
+	if len(b) < keyIDWidth+nonceWidth {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	id := enc.Uint32(b)
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("encryption key %d is missing", id)
+	}
+
+	p, err := aead.Open(nil, b[keyIDWidth:keyIDWidth+nonceWidth], b[keyIDWidth+nonceWidth:], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt with key %d: %w", id, err)
+	}
+
+	return p, nil
+}
+
+// encryptedMagic starts an encrypted stream. It can't be mistaken for the
+// start of a store file.
+var encryptedMagic = [4]byte{0xff, 'p', 'l', 'e'}
+
+const chunkSize = 64 << 10
+
+// encryptedWriter encrypts a stream in chunks sealed one by one. Each chunk
+// is bound to its index and the last one is flagged, so a reader notices
+// chunks that were reordered or a stream that was cut short.
+type encryptedWriter struct {
+	w       io.Writer
+	keyring *Keyring
+	buf     []byte
+	chunk   uint64
+}
+
+func newEncryptedWriter(w io.Writer, keyring *Keyring) (*encryptedWriter, error) {
+	_, err := w.Write(encryptedMagic[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptedWriter{
+		w:       w,
+		keyring: keyring,
+		buf:     make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (e *encryptedWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		if len(e.buf) == chunkSize {
+			err := e.writeChunk(false)
+			if err != nil {
+				return n, err
+			}
+		}
+
+		c := copy(e.buf[len(e.buf):chunkSize], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+	}
+
+	return n, nil
+}
+
+// Close writes the last chunk. It doesn't close the underlying writer.
+func (e *encryptedWriter) Close() error {
+	return e.writeChunk(true)
+}
+
+func (e *encryptedWriter) writeChunk(last bool) error {
+	b, err := e.keyring.seal(e.buf, chunkAdditionalData(e.chunk, last))
+	if err != nil {
+		return err
+	}
+	e.buf = e.buf[:0]
+	e.chunk++
+
+	size := make([]byte, 4)
+	enc.PutUint32(size, uint32(len(b)))
+	_, err = e.w.Write(append(size, b...))
+
+	return err
+}
+
+type encryptedReader struct {
+	r       io.Reader
+	keyring *Keyring
+	buf     []byte
+	chunk   uint64
+	last    bool
+}
+
+func (e *encryptedReader) Read(p []byte) (int, error) {
+	for len(e.buf) == 0 {
+		if e.last {
+			return 0, io.EOF
+		}
+
+		err := e.readChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, e.buf)
+	e.buf = e.buf[n:]
+
+	return n, nil
+}
+
+func (e *encryptedReader) readChunk() error {
+	size := make([]byte, 4)
+	_, err := io.ReadFull(e.r, size)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	n := enc.Uint32(size)
+	if n > chunkSize+keyIDWidth+nonceWidth+16 {
+		return fmt.Errorf("encrypted chunk of %d bytes is too large", n)
+	}
+
+	b := make([]byte, n)
+	_, err = io.ReadFull(e.r, b)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	// only the last chunk opens with its flag set
+	e.buf, err = e.keyring.open(b, chunkAdditionalData(e.chunk, false))
+	if err != nil {
+		e.buf, err = e.keyring.open(b, chunkAdditionalData(e.chunk, true))
+		if err != nil {
+			return err
+		}
+		e.last = true
+	}
+	e.chunk++
+
+	return nil
+}
+
+func chunkAdditionalData(chunk uint64, last bool) []byte {
+	b := make([]byte, 9)
+	enc.PutUint64(b, chunk)
+	if last {
+		b[8] = 1
+	}
+
+	return b
+}
+
+// decryptStream returns a reader of r's plaintext if r is an encrypted
+// stream, and a reader of r as is otherwise.
+func decryptStream(r io.Reader, keyring *Keyring) (io.Reader, error) {
+	magic := make([]byte, len(encryptedMagic))
+	n, err := io.ReadFull(r, magic)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return bytes.NewReader(magic[:n]), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(magic, encryptedMagic[:]) {
+		return io.MultiReader(bytes.NewReader(magic), r), nil
+	}
+
+	if keyring == nil {
+		return nil, errNoKeyring
+	}
+
+	return &encryptedReader{r: r, keyring: keyring}, nil
+}
@@ -1,10 +1,15 @@
 package log
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"slices"
+	"time"
 
 	"github.com/hashicorp/raft"
 	"google.golang.org/protobuf/proto"
@@ -15,17 +20,71 @@ import (
 type RequestType uint8
 
 const (
-	AppendRequestType RequestType = 0
+	AppendRequestType      RequestType = 0
+	AppendBatchRequestType RequestType = 1
+	CreateTopicRequestType RequestType = 2
+	DeleteTopicRequestType RequestType = 3
+	// CommitOffsetRequestType commits the offset of a consumer group.
+	CommitOffsetRequestType RequestType = 4
+	JoinGroupRequestType    RequestType = 5
+	LeaveGroupRequestType   RequestType = 6
+	InitProducerRequestType RequestType = 7
+	BeginTxnRequestType     RequestType = 8
+	CommitTxnRequestType    RequestType = 9
+	AbortTxnRequestType     RequestType = 10
 )
 
-var _ raft.FSM = (*fsm)(nil)
+var _ raft.BatchingFSM = (*fsm)(nil)
+
+// errNoRecord fails the appends of a request missing one of its records.
+var errNoRecord = errors.New("append without a record")
 
 type fsm struct {
-	log *Log
+	topics    *Topics
+	groups    *groups
+	producers *producers
+	txns      *txns
+}
+
+// A snapshot is made of typed sections following a header, so state other
+// than the logs of the topics can be added to it. Snapshots taken before
+// topics hold the store files of the default topic alone.
+var snapshotMagic = [4]byte{0xff, 'p', 'l', 's'}
+
+const (
+	// snapshotVersionPartition added the partition to the topic sections.
+	snapshotVersionPartition uint32 = 2
+	snapshotVersion                 = snapshotVersionPartition
+)
+
+type sectionKind uint8
+
+const (
+	// sectionTopic holds the partition and the lowest offset of a partition
+	// of a topic followed by the store files of its log. Sections before
+	// snapshotVersionPartition have no partition and hold the first one.
+	sectionTopic sectionKind = iota + 1
+	// sectionGroups holds the consumer groups as JSON.
+	sectionGroups
+	// sectionProducers holds the idempotent producers as JSON.
+	sectionProducers
+	// sectionTxns holds the open and aborted transactions as JSON.
+	sectionTxns
+)
+
+type section struct {
+	kind sectionKind
+	name string
+	size uint64
+	r    io.Reader
 }
 
 type snapshot struct {
-	reader io.Reader
+	sections []section
+	keyring  *Keyring
+	// logs holds the files of the partitions until the snapshot is
+	// released.
+	logs []*logSnapshot
 }
 
 func (l *fsm) Apply(record *raft.Log) interface{} {
@@ -35,54 +94,412 @@ func (l *fsm) Apply(record *raft.Log) interface{} {
 	switch reqType {
 	case AppendRequestType:
 		return l.applyAppend(buf[1:])
+	case AppendBatchRequestType:
+		return l.applyAppendBatch(buf[1:])
+	case CreateTopicRequestType:
+		return l.applyCreateTopic(buf[1:])
+	case DeleteTopicRequestType:
+		return l.applyDeleteTopic(buf[1:], record.AppendedAt)
+	case CommitOffsetRequestType:
+		return l.applyCommitOffset(buf[1:], record.AppendedAt)
+	case JoinGroupRequestType:
+		return l.applyJoinGroup(buf[1:])
+	case LeaveGroupRequestType:
+		return l.applyLeaveGroup(buf[1:])
+	case InitProducerRequestType:
+		return l.applyInitProducer(buf[1:])
+	case BeginTxnRequestType:
+		return l.applyBeginTxn(buf[1:])
+	case CommitTxnRequestType:
+		return l.applyCommitTxn(buf[1:])
+	case AbortTxnRequestType:
+		return l.applyAbortTxn(buf[1:])
 	}
 
 	return nil
 }
 
-func (l *fsm) Snapshot() (raft.FSMSnapshot, error) {
-	r := l.log.Reader()
-	return &snapshot{reader: r}, nil
+// ApplyBatch applies the committed logs raft hands over together. Runs of
+// consecutive appends to the same partition go to its log as one batch. The
+// appends of idempotent producers and transactions are applied one by one,
+// since they are checked first.
+func (l *fsm) ApplyBatch(logs []*raft.Log) []interface{} {
+	results := make([]interface{}, len(logs))
+
+	// appends holds the index of each append of the run and how many records
+	// it carries
+	type pending struct {
+		i, n  int
+		batch bool
+	}
+	var appends []pending
+	var records []*api.Record
+	var topic string
+	var partition uint32
+	flush := func() {
+		if len(appends) == 0 {
+			return
+		}
+
+		offset, err := l.topics.AppendBatch(topic, partition, records)
+		for _, a := range appends {
+			switch {
+			case err != nil:
+				results[a.i] = fmt.Errorf("append to log: %w", err)
+			case a.batch:
+				results[a.i] = &api.ProduceBatchResponse{
+					FirstOffset: offset,
+					LastOffset:  offset + uint64(a.n) - 1,
+				}
+			default:
+				results[a.i] = &api.ProduceResponse{Offset: offset, Partition: partition}
+			}
+			offset += uint64(a.n)
+		}
+		appends, records = appends[:0], records[:0]
+	}
+
+	for i, log := range logs {
+		if log.Type != raft.LogCommand {
+			continue
+		}
+
+		switch RequestType(log.Data[0]) {
+		case AppendRequestType:
+			var req api.ProduceRequest
+			err := proto.Unmarshal(log.Data[1:], &req)
+			if err != nil {
+				results[i] = fmt.Errorf("unmarshal protobuf: %w", err)
+				continue
+			}
+
+			if req.Record == nil || req.ProducerId != 0 || req.TxnId != 0 {
+				flush()
+				results[i] = l.Apply(log)
+				continue
+			}
+
+			if topicOrDefault(req.Topic) != topic || req.GetPartition() != partition {
+				flush()
+				topic, partition = topicOrDefault(req.Topic), req.GetPartition()
+			}
+			req.Record.TxnId = 0
+			appends = append(appends, pending{i: i, n: 1})
+			records = append(records, req.Record)
+		case AppendBatchRequestType:
+			var req api.ProduceBatchRequest
+			err := proto.Unmarshal(log.Data[1:], &req)
+			if err != nil {
+				results[i] = fmt.Errorf("unmarshal protobuf: %w", err)
+				continue
+			}
+
+			if len(req.Records) == 0 || slices.Contains(req.Records, nil) || req.ProducerId != 0 || req.TxnId != 0 {
+				flush()
+				results[i] = l.Apply(log)
+				continue
+			}
+
+			if topicOrDefault(req.Topic) != topic || req.GetPartition() != partition {
+				flush()
+				topic, partition = topicOrDefault(req.Topic), req.GetPartition()
+			}
+			for _, record := range req.Records {
+				record.TxnId = 0
+			}
+			appends = append(appends, pending{i: i, n: len(req.Records), batch: true})
+			records = append(records, req.Records...)
+		default:
+			flush()
+			results[i] = l.Apply(log)
+		}
+	}
+	flush()
+
+	return results
+}
+
+func (l *fsm) Snapshot() (_ raft.FSMSnapshot, err error) {
+	names, err := l.topics.ListTopics()
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot{keyring: l.topics.Config.Encryption.Keyring}
+	defer func() {
+		if err != nil {
+			snap.Release()
+		}
+	}()
+
+	err = l.snapshotTopics(snap, names)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := l.groups.marshal()
+	if err != nil {
+		return nil, fmt.Errorf("marshal consumer groups: %w", err)
+	}
+	snap.sections = append(snap.sections, section{
+		kind: sectionGroups,
+		size: uint64(len(groups)),
+		r:    bytes.NewReader(groups),
+	})
+
+	producers, err := l.producers.marshal()
+	if err != nil {
+		return nil, fmt.Errorf("marshal producers: %w", err)
+	}
+	snap.sections = append(snap.sections, section{
+		kind: sectionProducers,
+		size: uint64(len(producers)),
+		r:    bytes.NewReader(producers),
+	})
+
+	txns, err := l.txns.marshal()
+	if err != nil {
+		return nil, fmt.Errorf("marshal transactions: %w", err)
+	}
+	snap.sections = append(snap.sections, section{
+		kind: sectionTxns,
+		size: uint64(len(txns)),
+		r:    bytes.NewReader(txns),
+	})
+
+	return snap, nil
+}
+
+// snapshotTopics adds a section for every partition of the topics to the
+// snapshot.
+func (l *fsm) snapshotTopics(snap *snapshot, names []string) error {
+	for _, name := range names {
+		partitions, err := l.topics.Partitions(name)
+		if err != nil {
+			return err
+		}
+
+		for p := uint32(0); p < partitions; p++ {
+			log, err := l.topics.Log(name, p)
+			if err != nil {
+				return err
+			}
+
+			ls, err := log.snapshot()
+			if err != nil {
+				return fmt.Errorf("snapshot partition %d of topic %s: %w", p, name, err)
+			}
+			snap.logs = append(snap.logs, ls)
+
+			header := make([]byte, 12)
+			enc.PutUint32(header, p)
+			enc.PutUint64(header[4:], ls.lowest)
+			snap.sections = append(snap.sections, section{
+				kind: sectionTopic,
+				name: name,
+				size: uint64(len(header)) + ls.size,
+				r:    io.MultiReader(bytes.NewReader(header), ls),
+			})
+		}
+	}
+
+	return nil
 }
 
 func (l *fsm) Restore(r io.ReadCloser) error {
-	bLen := make([]byte, lenWidth)
-	var buf bytes.Buffer
-	for i := 0; ; i++ {
-		_, err := io.ReadFull(r, bLen)
+	keyring := l.topics.Config.Encryption.Keyring
+	plain, err := decryptStream(r, keyring)
+	if err != nil {
+		return fmt.Errorf("decrypt snapshot: %w", err)
+	}
+
+	br := bufio.NewReader(plain)
+	magic, err := br.Peek(len(snapshotMagic))
+	if err != nil || !bytes.Equal(magic, snapshotMagic[:]) {
+		// a snapshot of the default topic taken before topics
+		log, err := l.topics.Log(DefaultTopic, 0)
+		if err != nil {
+			return err
+		}
+
+		err = restoreLog(log, br, nil)
+		if err != nil {
+			return fmt.Errorf("restore default topic: %w", err)
+		}
+
+		err = l.topics.retain(map[string]bool{DefaultTopic: true})
+		if err != nil {
+			return err
+		}
+
+		err = l.groups.unmarshal(nil)
+		if err != nil {
+			return err
+		}
+
+		err = l.producers.unmarshal(nil)
+		if err != nil {
+			return err
+		}
+
+		err = l.txns.unmarshal(nil)
+		if err != nil {
+			return err
+		}
+
+		return l.topics.loadOffsets()
+	}
+
+	header := make([]byte, len(snapshotMagic)+4)
+	_, err = io.ReadFull(br, header)
+	if err != nil {
+		return fmt.Errorf("read snapshot header: %w", err)
+	}
+
+	version := enc.Uint32(header[len(snapshotMagic):])
+	if version > snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	topics := make(map[string]bool)
+	var groups, producers, txns []byte
+	for {
+		s, err := readSection(br)
 		if errors.Is(err, io.EOF) {
 			break
-		} else if err != nil {
-			return fmt.Errorf("read log length: %w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("read snapshot section: %w", err)
 		}
 
-		size := int64(enc.Uint64(bLen))
-		_, err = io.CopyN(&buf, r, size)
+		switch s.kind {
+		case sectionTopic:
+			err = l.restoreTopic(s, version)
+			topics[s.name] = true
+		case sectionGroups:
+			groups, err = io.ReadAll(s.r)
+		case sectionProducers:
+			producers, err = io.ReadAll(s.r)
+		case sectionTxns:
+			txns, err = io.ReadAll(s.r)
+		default:
+			err = fmt.Errorf("unknown snapshot section %d", s.kind)
+		}
 		if err != nil {
-			return fmt.Errorf("read log message: %w", err)
+			return err
 		}
 
-		record := &api.Record{}
-		err = proto.Unmarshal(buf.Bytes(), record)
+		// the rest of a section is skipped if it wasn't read to its end
+		_, err = io.Copy(io.Discard, s.r)
 		if err != nil {
-			return fmt.Errorf("unmarshal protobuf message: %w", err)
+			return fmt.Errorf("skip snapshot section: %w", err)
 		}
+	}
 
-		if i == 0 {
-			l.log.Config.Segment.InitialOffset = record.Offset
-			err = l.log.Reset()
-			if err != nil {
-				return fmt.Errorf("reset log: %w", err)
-			}
+	err = l.topics.retain(topics)
+	if err != nil {
+		return err
+	}
+
+	err = l.groups.unmarshal(groups)
+	if err != nil {
+		return fmt.Errorf("unmarshal consumer groups: %w", err)
+	}
+
+	err = l.producers.unmarshal(producers)
+	if err != nil {
+		return fmt.Errorf("unmarshal producers: %w", err)
+	}
+
+	err = l.txns.unmarshal(txns)
+	if err != nil {
+		return fmt.Errorf("unmarshal transactions: %w", err)
+	}
+
+	return l.topics.loadOffsets()
+}
+
+func (l *fsm) restoreTopic(s section, version uint32) error {
+	var partition uint32
+	if version >= snapshotVersionPartition {
+		b := make([]byte, 4)
+		_, err := io.ReadFull(s.r, b)
+		if err != nil {
+			return fmt.Errorf("read partition of topic %s: %w", s.name, err)
+		}
+		partition = enc.Uint32(b)
+	}
+
+	log, err := l.topics.ensure(s.name, partition)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	_, err = io.ReadFull(s.r, header)
+	if err != nil {
+		return fmt.Errorf("read lowest offset of topic %s: %w", s.name, err)
+	}
+	lowest := enc.Uint64(header)
+
+	err = restoreLog(log, s.r, &lowest)
+	if err != nil {
+		return fmt.Errorf("restore partition %d of topic %s: %w", partition, s.name, err)
+	}
+
+	return nil
+}
+
+// restoreLog replaces the records of the log with the ones read from the
+// store files in r. The log starts at lowest if it is given, and at the
+// offset of the first record otherwise.
+func restoreLog(l *Log, r io.Reader, lowest *uint64) error {
+	if lowest != nil {
+		l.Config.Segment.InitialOffset = *lowest
+		err := l.Reset()
+		if err != nil {
+			return fmt.Errorf("reset log: %w", err)
+		}
+	}
+
+	fr := &frameReader{r: r, keyring: l.Config.Encryption.Keyring}
+	for i := 0; ; {
+		b, err := fr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("read log frame: %w", err)
 		}
 
-		_, err = l.log.Append(record)
+		block, err := decodeBlock(fr.version, b)
 		if err != nil {
-			return fmt.Errorf("append to log: %w", err)
+			return fmt.Errorf("decode record block: %w", err)
 		}
 
-		buf.Reset()
+		for _, p := range block {
+			record := &api.Record{}
+			err = proto.Unmarshal(p, record)
+			if err != nil {
+				return fmt.Errorf("unmarshal protobuf message: %w", err)
+			}
+
+			if i == 0 && lowest == nil {
+				l.Config.Segment.InitialOffset = record.Offset
+				err = l.Reset()
+				if err != nil {
+					return fmt.Errorf("reset log: %w", err)
+				}
+			}
+			i++
+
+			// offsets are kept since the snapshot may come from a compacted log
+			err = l.appendAt(record)
+			if err != nil {
+				return fmt.Errorf("append to log: %w", err)
+			}
+		}
 	}
+
 	return nil
 }
 
@@ -93,16 +510,274 @@ func (l *fsm) applyAppend(b []byte) interface{} {
 		return fmt.Errorf("unmarshal protobuf: %w", err)
 	}
 
-	offset, err := l.log.Append(req.Record)
+	if req.Record == nil {
+		return errNoRecord
+	}
+
+	if req.ProducerId != 0 {
+		offset, dup, err := l.producers.lookup(req.ProducerId, req.ProducerEpoch, req.Topic, req.GetPartition(), req.Sequence)
+		if err != nil {
+			return err
+		}
+
+		if dup {
+			return &api.ProduceResponse{Offset: offset, Partition: req.GetPartition()}
+		}
+	}
+
+	if req.TxnId != 0 {
+		err = l.txns.check(req.TxnId, req.ProducerId, req.ProducerEpoch)
+		if err != nil {
+			return err
+		}
+	}
+
+	req.Record.TxnId = req.TxnId
+	offset, err := l.topics.Append(req.Topic, req.GetPartition(), req.Record)
+	if err != nil {
+		return fmt.Errorf("append to log: %w", err)
+	}
+
+	if req.ProducerId != 0 {
+		l.producers.record(req.ProducerId, req.Topic, req.GetPartition(), req.Sequence, offset)
+	}
+
+	if req.TxnId != 0 {
+		l.txns.record(req.TxnId, req.Topic, req.GetPartition(), offset)
+	}
+
+	return &api.ProduceResponse{Offset: offset, Partition: req.GetPartition()}
+}
+
+func (l *fsm) applyAppendBatch(b []byte) interface{} {
+	var req api.ProduceBatchRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return fmt.Errorf("unmarshal protobuf: %w", err)
+	}
+
+	if len(req.Records) == 0 {
+		return fmt.Errorf("append an empty batch")
+	}
+
+	if slices.Contains(req.Records, nil) {
+		return errNoRecord
+	}
+
+	if req.ProducerId != 0 {
+		offset, dup, err := l.producers.lookup(req.ProducerId, req.ProducerEpoch, req.Topic, req.GetPartition(), req.Sequence)
+		if err != nil {
+			return err
+		}
+
+		if dup {
+			return &api.ProduceBatchResponse{
+				FirstOffset: offset,
+				LastOffset:  offset + uint64(len(req.Records)) - 1,
+			}
+		}
+	}
+
+	if req.TxnId != 0 {
+		err = l.txns.check(req.TxnId, req.ProducerId, req.ProducerEpoch)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, record := range req.Records {
+		record.TxnId = req.TxnId
+	}
+	offset, err := l.topics.AppendBatch(req.Topic, req.GetPartition(), req.Records)
 	if err != nil {
 		return fmt.Errorf("append to log: %w", err)
 	}
 
-	return &api.ProduceResponse{Offset: offset}
+	if req.ProducerId != 0 {
+		l.producers.record(req.ProducerId, req.Topic, req.GetPartition(), req.Sequence, offset)
+	}
+
+	if req.TxnId != 0 {
+		l.txns.record(req.TxnId, req.Topic, req.GetPartition(), offset)
+	}
+
+	return &api.ProduceBatchResponse{
+		FirstOffset: offset,
+		LastOffset:  offset + uint64(len(req.Records)) - 1,
+	}
+}
+
+func (l *fsm) applyCreateTopic(b []byte) interface{} {
+	var req api.CreateTopicRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return fmt.Errorf("unmarshal protobuf: %w", err)
+	}
+
+	// the default topic always exists, the leader only adds partitions to it
+	if req.Name == DefaultTopic {
+		err = l.topics.open(DefaultTopic, req.Partitions)
+	} else {
+		err = l.topics.CreateTopic(req.Name, req.Partitions)
+	}
+	if err != nil {
+		return err
+	}
+
+	return &api.CreateTopicResponse{}
+}
+
+// applyDeleteTopic and applyCommitOffset stamp the records they append to
+// the offsets topic with the time the leader appended the raft log, so every
+// replica stores the same time.
+func (l *fsm) applyDeleteTopic(b []byte, at time.Time) interface{} {
+	var req api.DeleteTopicRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return fmt.Errorf("unmarshal protobuf: %w", err)
+	}
+
+	err = l.topics.DeleteTopic(req.Name, at.UnixNano())
+	if err != nil {
+		return err
+	}
+
+	return &api.DeleteTopicResponse{}
+}
+
+func (l *fsm) applyCommitOffset(b []byte, at time.Time) interface{} {
+	var req api.CommitOffsetRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return fmt.Errorf("unmarshal protobuf: %w", err)
+	}
+
+	// a member can only commit the partitions assigned to it
+	if req.MemberId != "" {
+		err = l.groups.checkPartition(req.Group, req.MemberId, req.Generation, req.Topic, req.Partition)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = l.topics.CommitOffset(req.Group, req.Topic, req.Partition, req.Offset, at.UnixNano())
+	if err != nil {
+		return err
+	}
+
+	return &api.CommitOffsetResponse{}
+}
+
+func (l *fsm) applyJoinGroup(b []byte) interface{} {
+	var req api.JoinGroupRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return fmt.Errorf("unmarshal protobuf: %w", err)
+	}
+
+	partitions, err := l.topics.Partitions(req.Topic)
+	if err != nil {
+		return err
+	}
+
+	res, err := l.groups.join(&req, partitions)
+	if err != nil {
+		return err
+	}
+
+	return res
+}
+
+func (l *fsm) applyLeaveGroup(b []byte) interface{} {
+	var req api.LeaveGroupRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return fmt.Errorf("unmarshal protobuf: %w", err)
+	}
+
+	// the partitions of a deleted topic are no longer assigned
+	topic, _ := l.groups.topic(req.Group)
+	partitions, _ := l.topics.Partitions(topic)
+
+	err = l.groups.leave(req.Group, req.MemberId, partitions)
+	if err != nil {
+		return err
+	}
+
+	return &api.LeaveGroupResponse{}
+}
+
+func (l *fsm) applyInitProducer(b []byte) interface{} {
+	var req api.InitProducerRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return fmt.Errorf("unmarshal protobuf: %w", err)
+	}
+
+	res, err := l.producers.init(req.ProducerId)
+	if err != nil {
+		return err
+	}
+
+	return res
+}
+
+// applyBeginTxn opens a transaction of the current epoch of the producer.
+func (l *fsm) applyBeginTxn(b []byte) interface{} {
+	var req api.BeginTxnRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return fmt.Errorf("unmarshal protobuf: %w", err)
+	}
+
+	err = l.producers.check(req.ProducerId, req.ProducerEpoch)
+	if err != nil {
+		return err
+	}
+
+	return &api.BeginTxnResponse{TxnId: l.txns.begin(req.ProducerId, req.ProducerEpoch)}
+}
+
+// applyCommitTxn commits the transaction. Its records are already in their
+// partitions, committing it only shows them to read_committed consumers.
+func (l *fsm) applyCommitTxn(b []byte) interface{} {
+	var req api.CommitTxnRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return fmt.Errorf("unmarshal protobuf: %w", err)
+	}
+
+	return l.txns.end(req.TxnId, req.ProducerId, req.ProducerEpoch, true, l.nextOffset)
+}
+
+func (l *fsm) applyAbortTxn(b []byte) interface{} {
+	var req api.AbortTxnRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return fmt.Errorf("unmarshal protobuf: %w", err)
+	}
+
+	return l.txns.end(req.TxnId, req.ProducerId, req.ProducerEpoch, false, l.nextOffset)
+}
+
+// nextOffset returns the next offset of the partition, or zero once it's
+// deleted.
+func (l *fsm) nextOffset(topic string, partition uint32) uint64 {
+	log, err := l.topics.Log(topic, partition)
+	if err != nil {
+		return 0
+	}
+
+	next, err := log.NextOffset()
+	if err != nil {
+		return 0
+	}
+
+	return next
 }
 
 func (s *snapshot) Persist(sink raft.SnapshotSink) error {
-	_, err := io.Copy(sink, s.reader)
+	err := s.persist(sink)
 	if err != nil {
 		_ = sink.Cancel()
 		return err
@@ -111,4 +786,105 @@ func (s *snapshot) Persist(sink raft.SnapshotSink) error {
 	return sink.Close()
 }
 
-func (s *snapshot) Release() {}
+func (s *snapshot) persist(w io.Writer) error {
+	if s.keyring == nil {
+		return s.write(w)
+	}
+
+	ew, err := newEncryptedWriter(w, s.keyring)
+	if err != nil {
+		return fmt.Errorf("start encrypted snapshot: %w", err)
+	}
+
+	err = s.write(ew)
+	if err != nil {
+		return err
+	}
+
+	return ew.Close()
+}
+
+func (s *snapshot) write(w io.Writer) error {
+	header := make([]byte, len(snapshotMagic)+4)
+	copy(header, snapshotMagic[:])
+	enc.PutUint32(header[len(snapshotMagic):], snapshotVersion)
+
+	bw := bufio.NewWriter(w)
+	_, err := bw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, sec := range s.sections {
+		err = writeSection(bw, sec)
+		if err != nil {
+			return fmt.Errorf("write section %s: %w", sec.name, err)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Release closes the files of the partitions.
+func (s *snapshot) Release() {
+	for _, ls := range s.logs {
+		_ = ls.Close()
+	}
+}
+
+// writeSection writes the kind, the name and the size of the section ahead
+// of its content.
+func writeSection(w io.Writer, s section) error {
+	if len(s.name) > math.MaxUint16 {
+		return fmt.Errorf("section name of %d bytes is too long", len(s.name))
+	}
+
+	header := []byte{byte(s.kind)}
+	header = binary.BigEndian.AppendUint16(header, uint16(len(s.name)))
+	header = append(header, s.name...)
+	header = binary.BigEndian.AppendUint64(header, s.size)
+	_, err := w.Write(header)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(w, s.r)
+	if err != nil {
+		return err
+	}
+
+	if uint64(n) != s.size {
+		return fmt.Errorf("wrote %d bytes of a %d bytes section", n, s.size)
+	}
+
+	return nil
+}
+
+// readSection reads the header of the next section. The returned section
+// reads its content from r.
+func readSection(r io.Reader) (section, error) {
+	b := make([]byte, 3)
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		return section{}, err
+	}
+
+	name := make([]byte, enc.Uint16(b[1:]))
+	_, err = io.ReadFull(r, name)
+	if err != nil {
+		return section{}, unexpectedEOF(err)
+	}
+
+	size := make([]byte, 8)
+	_, err = io.ReadFull(r, size)
+	if err != nil {
+		return section{}, unexpectedEOF(err)
+	}
+
+	return section{
+		kind: sectionKind(b[0]),
+		name: string(name),
+		size: enc.Uint64(size),
+		r:    io.LimitReader(r, int64(enc.Uint64(size))),
+	}, nil
+}
@@ -0,0 +1,235 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+)
+
+// defaultSessionTimeout is how long a member stays in its group without a
+// heartbeat when it joined without a session timeout.
+const defaultSessionTimeout = 10 * time.Second
+
+// groupNameRegexp keeps the group names to the characters of the topic
+// names, so a group can't carry the separator of the keys of the committed
+// offsets.
+var groupNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// groups holds the members of the consumer groups and the partitions
+// assigned to them. It is state of the FSM, so every change to it is applied
+// through raft and every replica assigns the same partitions.
+type groups struct {
+	mu     sync.RWMutex
+	groups map[string]*group
+}
+
+// group is kept in the snapshots as JSON.
+type group struct {
+	Topic      string             `json:"topic"`
+	Generation uint64             `json:"generation"`
+	Members    map[string]*member `json:"members"`
+	// Assignment holds the partitions of every member by ID.
+	Assignment map[string][]uint32 `json:"assignment"`
+}
+
+type member struct {
+	SessionTimeout time.Duration `json:"session_timeout"`
+}
+
+// groupMember names a member of a group with its session timeout.
+type groupMember struct {
+	group          string
+	id             string
+	sessionTimeout time.Duration
+}
+
+func validateGroup(name string) error {
+	if !groupNameRegexp.MatchString(name) {
+		return api.InvalidGroupError{
+			Group:  name,
+			Reason: "group names are 1 to 249 letters, digits, '.', '_' or '-'",
+		}
+	}
+
+	return nil
+}
+
+func newGroups() *groups {
+	return &groups{groups: make(map[string]*group)}
+}
+
+// join adds the member to the group and assigns the partitions again. A
+// member already in the group gets its assignment of the current
+// generation.
+func (g *groups) join(req *api.JoinGroupRequest, partitions uint32) (*api.JoinGroupResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	topic := topicOrDefault(req.Topic)
+	grp, ok := g.groups[req.Group]
+	if !ok {
+		grp = &group{
+			Topic:      topic,
+			Members:    make(map[string]*member),
+			Assignment: make(map[string][]uint32),
+		}
+		g.groups[req.Group] = grp
+	}
+
+	if grp.Topic != topic {
+		return nil, fmt.Errorf("group %s consumes topic %s, not %s", req.Group, grp.Topic, topic)
+	}
+
+	if _, ok := grp.Members[req.MemberId]; !ok {
+		timeout := time.Duration(req.SessionTimeoutMs) * time.Millisecond
+		if timeout <= 0 {
+			timeout = defaultSessionTimeout
+		}
+
+		grp.Members[req.MemberId] = &member{SessionTimeout: timeout}
+		grp.rebalance(partitions)
+	}
+
+	return &api.JoinGroupResponse{
+		MemberId:   req.MemberId,
+		Generation: grp.Generation,
+		Partitions: grp.Assignment[req.MemberId],
+	}, nil
+}
+
+// leave removes the member from the group and assigns its partitions to the
+// members left. The group is dropped with its last member.
+func (g *groups) leave(name, memberID string, partitions uint32) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	grp, ok := g.groups[name]
+	if !ok || grp.Members[memberID] == nil {
+		return api.UnknownMemberError{Group: name, MemberID: memberID}
+	}
+
+	delete(grp.Members, memberID)
+	if len(grp.Members) == 0 {
+		delete(g.groups, name)
+		return nil
+	}
+
+	grp.rebalance(partitions)
+
+	return nil
+}
+
+// check returns an error unless the member is in the group for the
+// generation.
+func (g *groups) check(name, memberID string, generation uint64) error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	_, err := g.checkLocked(name, memberID, generation)
+
+	return err
+}
+
+// checkPartition returns an error unless the partition is assigned to the
+// member for the generation.
+func (g *groups) checkPartition(name, memberID string, generation uint64, topic string, partition uint32) error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	grp, err := g.checkLocked(name, memberID, generation)
+	if err != nil {
+		return err
+	}
+
+	if grp.Topic != topicOrDefault(topic) || !slices.Contains(grp.Assignment[memberID], partition) {
+		return fmt.Errorf("partition %d of topic %s isn't assigned to member %s", partition, topicOrDefault(topic), memberID)
+	}
+
+	return nil
+}
+
+func (g *groups) checkLocked(name, memberID string, generation uint64) (*group, error) {
+	grp, ok := g.groups[name]
+	if !ok || grp.Members[memberID] == nil {
+		return nil, api.UnknownMemberError{Group: name, MemberID: memberID}
+	}
+
+	if grp.Generation != generation {
+		return nil, api.StaleGenerationError{Group: name, Generation: generation, Current: grp.Generation}
+	}
+
+	return grp, nil
+}
+
+// topic returns the topic the group consumes.
+func (g *groups) topic(name string) (string, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	grp, ok := g.groups[name]
+	if !ok {
+		return "", false
+	}
+
+	return grp.Topic, true
+}
+
+func (g *groups) members() []groupMember {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var members []groupMember
+	for name, grp := range g.groups {
+		for id, m := range grp.Members {
+			members = append(members, groupMember{group: name, id: id, sessionTimeout: m.SessionTimeout})
+		}
+	}
+
+	return members
+}
+
+func (g *groups) marshal() ([]byte, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return json.Marshal(g.groups)
+}
+
+func (g *groups) unmarshal(b []byte) error {
+	groups := make(map[string]*group)
+	if len(b) > 0 {
+		err := json.Unmarshal(b, &groups)
+		if err != nil {
+			return err
+		}
+	}
+
+	g.mu.Lock()
+	g.groups = groups
+	g.mu.Unlock()
+
+	return nil
+}
+
+// rebalance starts the next generation of the group and deals the
+// partitions out to its members in turn, in the order of their IDs.
+func (grp *group) rebalance(partitions uint32) {
+	ids := make([]string, 0, len(grp.Members))
+	for id := range grp.Members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	grp.Generation++
+	grp.Assignment = make(map[string][]uint32, len(ids))
+	for p := uint32(0); p < partitions; p++ {
+		id := ids[int(p)%len(ids)]
+		grp.Assignment[id] = append(grp.Assignment[id], p)
+	}
+}
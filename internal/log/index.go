@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 
 	"github.com/tysonmote/gommap"
 )
@@ -66,6 +67,26 @@ func (i *index) Read(in int64) (out uint32, pos uint64, err error) {
 	return out, pos, nil
 }
 
+// Find returns the entry of the relative offset off. Compacted segments
+// have gaps in their offsets, in which case the entry of the first offset
+// after off is returned.
+func (i *index) Find(off uint32) (out uint32, pos uint64, err error) {
+	entries := i.size / entryWidth
+	if uint64(off) < entries {
+		out, pos, err = i.Read(int64(off))
+		if err == nil && out == off {
+			return out, pos, nil
+		}
+	}
+
+	j := sort.Search(int(entries), func(j int) bool {
+		at := uint64(j) * entryWidth
+		return enc.Uint32(i.mmap[at:at+offWidth]) >= off
+	})
+
+	return i.Read(int64(j))
+}
+
 func (i *index) Write(off uint32, pos uint64) error {
 	if uint64(len(i.mmap)) < i.size+entryWidth {
 		return io.EOF
@@ -78,6 +99,87 @@ func (i *index) Write(off uint32, pos uint64) error {
 	return nil
 }
 
+// rebuild makes the index agree with the frame positions scanned from the
+// store. The records of a frame share its position. Entries that already
+// match are kept, the rest are rewritten with the relative offsets offsetsAt
+// reads from the frame at their position.
+func (i *index) rebuild(positions []uint64, offsetsAt func(pos uint64) ([]uint32, error)) error {
+	entries := min(i.size, uint64(len(i.mmap))) / entryWidth
+
+	// frame is the frame of the last valid entry
+	var valid uint64
+	frame := 0
+	for ; valid < entries; valid++ {
+		at := valid * entryWidth
+		off := enc.Uint32(i.mmap[at : at+offWidth])
+		pos := enc.Uint64(i.mmap[at+offWidth : at+entryWidth])
+
+		next := frame
+		if valid > 0 {
+			prevOff := enc.Uint32(i.mmap[at-entryWidth : at-entryWidth+offWidth])
+			if off <= prevOff {
+				break
+			}
+
+			if pos != positions[frame] {
+				next++
+			}
+		}
+
+		if next == len(positions) || pos != positions[next] {
+			break
+		}
+		frame = next
+	}
+
+	// the last frame kept may be only partly indexed, so it is indexed again
+	for valid > 0 {
+		at := (valid - 1) * entryWidth
+		if enc.Uint64(i.mmap[at+offWidth:at+entryWidth]) != positions[frame] {
+			break
+		}
+		valid--
+	}
+
+	i.size = valid * entryWidth
+	for _, pos := range positions[frame:] {
+		offs, err := offsetsAt(pos)
+		if err != nil {
+			return fmt.Errorf("read offsets of frame at position %d: %w", pos, err)
+		}
+
+		for _, off := range offs {
+			err = i.Write(off, pos)
+			if err != nil {
+				return fmt.Errorf("write index entry for offset %d: %w", off, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// seal syncs the index and shrinks its file to the written entries, so the
+// file is consistent on disk once the index stops taking writes.
+func (i *index) seal() error {
+	err := i.mmap.Sync(gommap.MS_SYNC)
+	if err != nil {
+		return fmt.Errorf("sync index memory-mapped file to disk: %w", err)
+	}
+
+	err = i.file.Truncate(int64(i.size))
+	if err != nil {
+		return fmt.Errorf("set the file size to actual logs size: %w", err)
+	}
+
+	err = i.file.Sync()
+	if err != nil {
+		return fmt.Errorf("sync index file to disk: %w", err)
+	}
+
+	return nil
+}
+
 func (i *index) Name() string {
 	return i.file.Name()
 }
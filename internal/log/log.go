@@ -1,29 +1,53 @@
 package log
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	"go.uber.org/zap"
 
 	api "github.com/huytran2000-hcmus/proglog/api/v1"
 )
 
+const (
+	// compactionDir is where compacted segments are written before they
+	// replace the original ones.
+	compactionDir = "compaction"
+	swapExt       = ".swap"
+)
+
+var segmentExts = []string{".store", ".index", ".timeindex"}
+
+// ErrClosed is returned to the readers waiting for records on a closed log.
+var ErrClosed = errors.New("log is closed")
+
 type Log struct {
-	Config        Config
-	mu            sync.RWMutex
+	Config Config
+	mu     sync.RWMutex
+	// compactMu keeps the sealed segments a compaction reads without mu
+	// from being closed or removed under it. It is taken before mu.
+	compactMu     sync.Mutex
 	Dir           string
 	activeSegment *segment
 	segments      []*segment
-}
-
-type originReader struct {
-	store  *store
-	offset int64
+	unsynced      uint64
+	// appended is closed and replaced every time records are appended, to
+	// wake up the readers waiting for them.
+	appended  chan struct{}
+	logger    *zap.Logger
+	closed    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
 }
 
 func New(dir string, c Config) (*Log, error) {
@@ -35,77 +59,263 @@ func New(dir string, c Config) (*Log, error) {
 		c.Segment.MaxIndexBytes = 10000
 	}
 
+	if c.Segment.TimeIndexIntervalBytes == 0 {
+		c.Segment.TimeIndexIntervalBytes = 4096
+	}
+
+	if c.Sync.EveryN == 0 {
+		c.Sync.EveryN = 1000
+	}
+
+	if c.Sync.Interval == 0 {
+		c.Sync.Interval = time.Second
+	}
+
+	if c.Retention.CheckInterval == 0 {
+		c.Retention.CheckInterval = time.Minute
+	}
+
+	if c.Compaction.Interval == 0 {
+		c.Compaction.Interval = 10 * time.Minute
+	}
+
 	l := &Log{
-		Dir:    dir,
-		Config: c,
+		Dir:      dir,
+		Config:   c,
+		appended: make(chan struct{}),
+		logger:   zap.L().Named("log"),
+		closed:   make(chan struct{}),
+	}
+
+	err := l.setup()
+	if err != nil {
+		return nil, err
 	}
 
-	return l, l.setup()
+	if c.Sync.Policy == SyncInterval {
+		l.background("sync", c.Sync.Interval, l.Sync)
+	}
+
+	if c.Retention.MaxAge != 0 || c.Retention.MaxBytes != 0 {
+		l.background("retention", c.Retention.CheckInterval, l.EnforceRetention)
+	}
+
+	if c.Compaction.Enabled {
+		l.background("compaction", c.Compaction.Interval, l.Compact)
+	}
+
+	return l, nil
 }
 
 func (l *Log) Append(record *api.Record) (uint64, error) {
+	return l.AppendBatch([]*api.Record{record})
+}
+
+// AppendBatch appends the records under one lock, each segment they span
+// taking them as one block, and returns the offset of the first one. The
+// records without a timestamp get the current time, so the replicated logs
+// stamp theirs before they are applied.
+func (l *Log) AppendBatch(records []*api.Record) (uint64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	off, err := l.activeSegment.Append(record)
+	now := time.Now().UnixNano()
+	for _, record := range records {
+		if record.Timestamp == 0 {
+			record.Timestamp = now
+		}
+	}
+
+	first := l.activeSegment.nextOffset
+	defer l.notify(first)
+	for len(records) > 0 {
+		n, err := l.activeSegment.AppendBatch(records)
+		if err != nil {
+			return 0, fmt.Errorf("append to segment: %w", err)
+		}
+		full := n < len(records)
+		records = records[n:]
+
+		err = l.maybeSync(uint64(n))
+		if err != nil {
+			return 0, fmt.Errorf("sync log: %w", err)
+		}
+
+		if full || l.activeSegment.IsMaxed() {
+			err = l.newSegment(l.activeSegment.nextOffset)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return first, nil
+}
+
+// appendAt appends the record keeping its offset, which must not be lower
+// than the next offset of the log.
+func (l *Log) appendAt(record *api.Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.activeSegment.write(record)
+	if err != nil {
+		return fmt.Errorf("write to segment: %w", err)
+	}
+	l.notify(record.Offset)
+
+	err = l.maybeSync(1)
 	if err != nil {
-		return 0, fmt.Errorf("append to segment: %w", err)
+		return fmt.Errorf("sync log: %w", err)
 	}
 
 	if l.activeSegment.IsMaxed() {
-		err = l.newSegment(off + 1)
+		return l.newSegment(record.Offset + 1)
 	}
 
-	return off, err
+	return nil
+}
+
+// Wait blocks until the record at offset is appended, ctx is done or the log
+// is closed. It returns right away for offsets already in the log.
+func (l *Log) Wait(ctx context.Context, offset uint64) error {
+	for {
+		l.mu.RLock()
+		next := l.activeSegment.nextOffset
+		appended := l.appended
+		l.mu.RUnlock()
+
+		if offset < next {
+			return nil
+		}
+
+		select {
+		case <-appended:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.closed:
+			return ErrClosed
+		}
+	}
 }
 
+// notify wakes up the readers waiting for new records if any record was
+// appended since first. It must be called with the lock held.
+func (l *Log) notify(first uint64) {
+	if l.activeSegment.nextOffset == first {
+		return
+	}
+
+	close(l.appended)
+	l.appended = make(chan struct{})
+}
+
+// Read returns the record at offset. If compaction removed the record, the
+// first record after it is returned instead.
 func (l *Log) Read(offset uint64) (*api.Record, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 
-	var s *segment
-	for _, seg := range l.segments {
-		if seg.InRange(offset) {
-			s = seg
+	lowest := l.segments[0].baseOffset
+	if offset >= lowest {
+		for _, s := range l.segments {
+			if s.nextOffset <= offset {
+				continue
+			}
+
+			record, err := s.Read(max(offset, s.baseOffset))
+			if errors.Is(err, io.EOF) {
+				// the rest of the segment was compacted away
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("read record from offset: %w", err)
+			}
+
+			return record, nil
 		}
 	}
 
-	if s == nil {
-		return nil, api.OffsetOutOfRangeError{Offset: offset}
+	return nil, api.OffsetOutOfRangeError{
+		Offset: offset,
+		Lowest: lowest,
 	}
+}
 
-	record, err := s.Read(offset)
-	if err != nil {
-		return nil, fmt.Errorf("read record from offset: %w", err)
+// OffsetForTime returns the first offset whose record is not older than t,
+// or the next offset to be appended if every record is older.
+func (l *Log) OffsetForTime(t time.Time) (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	timestamp := t.UnixNano()
+	for _, s := range l.segments {
+		offset, ok, err := s.OffsetForTime(timestamp)
+		if err != nil {
+			return 0, fmt.Errorf("find offset in segment %d: %w", s.baseOffset, err)
+		}
+
+		if ok {
+			return offset, nil
+		}
+	}
+
+	return l.activeSegment.nextOffset, nil
+}
+
+// Reader returns a reader of the store files as they are now. Closing it
+// releases the files.
+func (l *Log) Reader() (io.ReadCloser, error) {
+	return l.snapshot()
+}
+
+// logSnapshot reads the store files of a log as they were when it was taken.
+// It holds its own handles of the files, so retention and compaction can
+// remove or replace them while it's read.
+type logSnapshot struct {
+	io.Reader
+	size   uint64
+	lowest uint64
+	files  []*os.File
+}
+
+func (s *logSnapshot) Close() error {
+	var err error
+	for _, f := range s.files {
+		err = errors.Join(err, f.Close())
 	}
 
-	return record, nil
+	return err
 }
 
-func (l *Log) Reader() io.Reader {
+// snapshot returns a snapshot of the store files as they are now, with
+// their total size and the lowest offset of the log.
+func (l *Log) snapshot() (*logSnapshot, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 
+	snap := &logSnapshot{lowest: l.segments[0].baseOffset}
 	readers := make([]io.Reader, len(l.segments))
 	for i, s := range l.segments {
-		r := &originReader{
-			store:  s.store,
-			offset: 0,
+		f, err := s.store.open()
+		if err != nil {
+			_ = snap.Close()
+			return nil, fmt.Errorf("open store of segment %d: %w", s.baseOffset, err)
 		}
+		snap.files = append(snap.files, f)
 
-		readers[i] = r
+		readers[i] = io.NewSectionReader(f, 0, int64(s.store.size))
+		snap.size += s.store.size
 	}
+	snap.Reader = io.MultiReader(readers...)
 
-	return io.MultiReader(readers...)
-}
-
-func (o *originReader) Read(p []byte) (int, error) {
-	n, err := o.store.ReadAt(p, o.offset)
-	o.offset += int64(n)
-	return n, err
+	return snap, nil
 }
 
 func (l *Log) Truncate(lowest uint64) error {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -126,14 +336,324 @@ func (l *Log) Truncate(lowest uint64) error {
 	return nil
 }
 
+// EnforceRetention removes the oldest segments for as long as they are older
+// than Retention.MaxAge or the log is larger than Retention.MaxBytes. The
+// active segment is never removed.
+func (l *Log) EnforceRetention() error {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var size uint64
+	for _, s := range l.segments {
+		size += s.store.size
+	}
+
+	now := time.Now()
+	maxAge, maxBytes := l.Config.Retention.MaxAge, l.Config.Retention.MaxBytes
+
+	var removed int
+	for _, s := range l.segments[:len(l.segments)-1] {
+		newest, err := s.newestTimestamp()
+		if err != nil {
+			return fmt.Errorf("get newest timestamp of segment %d: %w", s.baseOffset, err)
+		}
+
+		expired := maxAge != 0 && now.Sub(newest) > maxAge
+		oversized := maxBytes != 0 && size > maxBytes
+		if !expired && !oversized {
+			break
+		}
+
+		storeSize := s.store.size
+		err = s.Remove()
+		if err != nil {
+			return fmt.Errorf("remove segment %d: %w", s.baseOffset, err)
+		}
+
+		size -= storeSize
+		removed++
+	}
+
+	l.segments = l.segments[removed:]
+
+	return nil
+}
+
+// Compact rewrites the segments before the active one keeping only the
+// newest record of every key. Records without a key are always kept, and so
+// is a tombstone, a keyed record without a value, when it is the newest
+// record of its key. The surviving records keep their offsets. The records
+// of open transactions are kept and those of aborted ones dropped, neither
+// superseding the committed records of their key, which read_committed
+// consumers still read.
+//
+// The sealed segments aren't written to, so they are read and rewritten
+// without the lock, and appends and reads go on meanwhile. The lock is only
+// taken to scan the active segment and to swap the rewritten segments in.
+func (l *Log) Compact() error {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
+	latest := make(map[string]uint64)
+	l.mu.RLock()
+	segments := append([]*segment(nil), l.segments...)
+	err := l.addKeys(l.activeSegment, latest)
+	l.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("read keys of active segment: %w", err)
+	}
+
+	if len(segments) < 2 {
+		return nil
+	}
+
+	sealed := segments[:len(segments)-1]
+	for _, s := range sealed {
+		err := l.addKeys(s, latest)
+		if err != nil {
+			return fmt.Errorf("read keys of segment %d: %w", s.baseOffset, err)
+		}
+	}
+
+	compacted := make(map[*segment]*segment)
+	for _, s := range sealed {
+		cleaned, changed, err := l.compactSegment(s, latest)
+		if err != nil {
+			removeCompacted(compacted)
+			return fmt.Errorf("compact segment %d: %w", s.baseOffset, err)
+		}
+
+		if changed {
+			compacted[s] = cleaned
+		}
+	}
+
+	if len(compacted) == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// compactMu kept the sealed segments from being removed, so they are
+	// all still in the log
+	segments = make([]*segment, 0, len(l.segments))
+	for _, s := range l.segments {
+		cleaned, ok := compacted[s]
+		if !ok {
+			segments = append(segments, s)
+			continue
+		}
+		delete(compacted, s)
+
+		if cleaned == nil {
+			err = s.Remove()
+			if err != nil {
+				removeCompacted(compacted)
+				return fmt.Errorf("remove compacted segment %d: %w", s.baseOffset, err)
+			}
+			continue
+		}
+
+		swapped, err := l.replaceSegment(s, cleaned)
+		if err != nil {
+			removeCompacted(compacted)
+			return fmt.Errorf("swap compacted segment %d: %w", s.baseOffset, err)
+		}
+		segments = append(segments, swapped)
+	}
+	l.segments = segments
+
+	return nil
+}
+
+// addKeys records the offset of the newest committed record of every key of
+// s in latest.
+func (l *Log) addKeys(s *segment, latest map[string]uint64) error {
+	return s.forEach(func(record *api.Record) error {
+		if len(record.Key) == 0 || l.txnStatus(record.TxnId) != txnCommitted {
+			return nil
+		}
+
+		offset, ok := latest[string(record.Key)]
+		if !ok || record.Offset > offset {
+			latest[string(record.Key)] = record.Offset
+		}
+
+		return nil
+	})
+}
+
+// compactSegment writes the records of s that survive compaction to a new
+// segment in the compaction directory. It reports whether any record was
+// dropped, and returns a nil segment if none survived.
+func (l *Log) compactSegment(s *segment, latest map[string]uint64) (*segment, bool, error) {
+	dir := filepath.Join(l.Dir, compactionDir)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, false, fmt.Errorf("create compaction dir: %w", err)
+	}
+
+	cleaned, err := newSegment(dir, s.baseOffset, l.Config)
+	if err != nil {
+		return nil, false, fmt.Errorf("create compacted segment: %w", err)
+	}
+
+	var total, kept int
+	err = s.forEach(func(record *api.Record) error {
+		total++
+		if len(record.Key) != 0 && l.txnStatus(record.TxnId) != txnOpen {
+			offset, ok := latest[string(record.Key)]
+			if !ok || offset != record.Offset {
+				return nil
+			}
+		}
+
+		kept++
+		return cleaned.write(record)
+	})
+	if err == nil {
+		err = cleaned.seal()
+	}
+	if err != nil {
+		_ = cleaned.Remove()
+		return nil, false, err
+	}
+
+	switch {
+	case kept == total:
+		return nil, false, cleaned.Remove()
+	case kept == 0:
+		return nil, true, cleaned.Remove()
+	}
+
+	return cleaned, true, nil
+}
+
+// txnStatus returns the state of the transaction of a record.
+func (l *Log) txnStatus(id uint64) txnStatus {
+	if id == 0 || l.Config.Compaction.txnStatus == nil {
+		return txnCommitted
+	}
+
+	return l.Config.Compaction.txnStatus(id)
+}
+
+// removeCompacted removes the compacted segments that weren't swapped in.
+func removeCompacted(compacted map[*segment]*segment) {
+	for _, cleaned := range compacted {
+		if cleaned != nil {
+			_ = cleaned.Remove()
+		}
+	}
+}
+
+// replaceSegment swaps the compacted segment cleaned in place of s, and
+// returns it opened from the log dir. It must be called with the lock held.
+func (l *Log) replaceSegment(s, cleaned *segment) (*segment, error) {
+	err := cleaned.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// the marker tells setup the compacted segment is complete, so a swap
+	// interrupted by a crash is finished instead of dropped
+	dir := filepath.Join(l.Dir, compactionDir)
+	marker := filepath.Join(dir, fmt.Sprintf("%d%s", s.baseOffset, swapExt))
+	f, err := os.Create(marker)
+	if err != nil {
+		return nil, fmt.Errorf("create swap marker: %w", err)
+	}
+
+	err = f.Sync()
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sync swap marker: %w", err)
+	}
+
+	err = l.swapSegment(s.baseOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSegment(l.Dir, s.baseOffset, l.Config)
+}
+
+// swapSegment moves the files of a compacted segment over the ones of the
+// segment it replaces and removes its swap marker.
+func (l *Log) swapSegment(baseOffset uint64) error {
+	dir := filepath.Join(l.Dir, compactionDir)
+	for _, ext := range segmentExts {
+		name := fmt.Sprintf("%d%s", baseOffset, ext)
+		err := os.Rename(filepath.Join(dir, name), filepath.Join(l.Dir, name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("swap %s: %w", name, err)
+		}
+	}
+
+	return os.Remove(filepath.Join(dir, fmt.Sprintf("%d%s", baseOffset, swapExt)))
+}
+
+// finishCompaction completes the swaps a crash interrupted and drops the
+// compacted segments that were still being written.
+func (l *Log) finishCompaction() error {
+	dir := filepath.Join(l.Dir, compactionDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read compaction dir: %w", err)
+	}
+
+	for _, ent := range entries {
+		fname := ent.Name()
+		if filepath.Ext(fname) != swapExt {
+			continue
+		}
+
+		offset, err := strconv.ParseUint(strings.TrimSuffix(fname, swapExt), 10, 64)
+		if err != nil {
+			return fmt.Errorf("parse offset: %w", err)
+		}
+
+		err = l.swapSegment(offset)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.RemoveAll(dir)
+}
+
 func (l *Log) setup() error {
+	err := l.finishCompaction()
+	if err != nil {
+		return fmt.Errorf("finish compaction: %w", err)
+	}
+
 	entries, err := os.ReadDir(l.Dir)
 	if err != nil {
 		return fmt.Errorf("read log dir: %w", err)
 	}
 
 	var baseOffsets []uint64
+	seen := make(map[uint64]bool)
 	for _, ent := range entries {
+		if ent.IsDir() {
+			continue
+		}
+
 		fname := ent.Name()
 		ext := filepath.Ext(fname)
 		offsetStr := strings.TrimSuffix(fname, ext)
@@ -142,6 +662,13 @@ func (l *Log) setup() error {
 			return fmt.Errorf("parse offset: %w", err)
 		}
 
+		// the store and index of a segment share the base offset, and either
+		// one may be missing after a crash
+		if seen[offset] {
+			continue
+		}
+		seen[offset] = true
+
 		baseOffsets = append(baseOffsets, offset)
 	}
 
@@ -149,14 +676,11 @@ func (l *Log) setup() error {
 		return baseOffsets[i] < baseOffsets[j]
 	})
 
-	for i := 0; i < len(baseOffsets); i++ {
-		err = l.newSegment(baseOffsets[i])
+	for _, offset := range baseOffsets {
+		err = l.newSegment(offset)
 		if err != nil {
-			return fmt.Errorf("create segment from existed offset=%d: %w", i, err)
+			return fmt.Errorf("create segment from existed offset=%d: %w", offset, err)
 		}
-
-		// skip because duplication of index and store
-		i++
 	}
 
 	if len(l.segments) == 0 {
@@ -166,42 +690,170 @@ func (l *Log) setup() error {
 		}
 	}
 
-	return nil
-}
+	// only the active segment can have a torn tail, the older ones were
+	// sealed when the log rolled past them
+	err = l.activeSegment.recover()
+	if err != nil {
+		return fmt.Errorf("recover active segment: %w", err)
+	}
 
-func (l *Log) Close() error {
-	for _, s := range l.segments {
-		err := s.Close()
+	// segments written in an older store format are kept read-only
+	if l.activeSegment.store.version != storeVersion {
+		err = l.newSegment(l.activeSegment.nextOffset)
 		if err != nil {
-			return fmt.Errorf("close segment: %w", err)
+			return fmt.Errorf("roll legacy segment: %w", err)
 		}
 	}
 
 	return nil
 }
 
-func (l *Log) Remove() error {
+// Sync flushes the records appended since the last sync to disk.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.sync()
+}
+
+func (l *Log) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	l.wg.Wait()
+
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if l.Config.Sync.Policy != SyncNever {
+		err := l.sync()
+		if err != nil {
+			return fmt.Errorf("sync log: %w", err)
+		}
+	}
+
+	return l.closeSegments()
+}
+
+func (l *Log) Remove() error {
 	err := l.Close()
 	if err != nil {
 		return err
 	}
 
-	return os.Remove(l.Dir)
+	return os.RemoveAll(l.Dir)
 }
 
 func (l *Log) Reset() error {
+	l.compactMu.Lock()
+	defer l.compactMu.Unlock()
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	err := l.Remove()
+	err := l.closeSegments()
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(l.Dir)
+	if err != nil {
+		return fmt.Errorf("remove log dir: %w", err)
+	}
+
+	err = os.MkdirAll(l.Dir, 0755)
+	if err != nil {
+		return fmt.Errorf("create log dir: %w", err)
+	}
+
+	l.segments = nil
+	l.activeSegment = nil
+	l.unsynced = 0
+
+	err = l.setup()
 	if err != nil {
 		return err
 	}
 
-	return l.setup()
+	// the waiting readers check the offsets they wait for against the new log
+	close(l.appended)
+	l.appended = make(chan struct{})
+
+	return nil
+}
+
+func (l *Log) closeSegments() error {
+	for _, s := range l.segments {
+		err := s.Close()
+		if err != nil {
+			return fmt.Errorf("close segment: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// maybeSync records n more appended records and syncs them if the sync
+// policy asks for it.
+func (l *Log) maybeSync(n uint64) error {
+	l.unsynced += n
+
+	switch l.Config.Sync.Policy {
+	case SyncAlways:
+		return l.sync()
+	case SyncEveryN:
+		if l.unsynced >= l.Config.Sync.EveryN {
+			return l.sync()
+		}
+	}
+
+	return nil
+}
+
+// sync fsyncs the active segment's store. Its index doesn't need to reach the
+// disk since it is rebuilt from the store after a crash.
+func (l *Log) sync() error {
+	if l.unsynced == 0 {
+		return nil
+	}
+
+	err := l.activeSegment.store.Sync()
+	if err != nil {
+		return err
+	}
+	l.unsynced = 0
+
+	return nil
+}
+
+// background runs fn every interval until the log is closed.
+func (l *Log) background(name string, interval time.Duration, fn func() error) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.closed:
+				return
+			case <-ticker.C:
+				err := fn()
+				if err != nil {
+					l.logger.Error(
+						"background task failed",
+						zap.Error(err),
+						zap.String("task", name),
+						zap.String("dir", l.Dir),
+					)
+				}
+			}
+		}
+	}()
 }
 
 func (l *Log) LowestOffset() (uint64, error) {
@@ -223,7 +875,31 @@ func (l *Log) HighestOffset() (uint64, error) {
 	return offset - 1, nil
 }
 
+// NextOffset returns the offset the next record is appended at.
+func (l *Log) NextOffset() (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.activeSegment.nextOffset, nil
+}
+
+// Segments returns the number of segments of the log.
+func (l *Log) Segments() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.segments)
+}
+
 func (l *Log) newSegment(offset uint64) error {
+	if l.activeSegment != nil {
+		err := l.activeSegment.seal()
+		if err != nil {
+			return fmt.Errorf("seal active segment: %w", err)
+		}
+		l.unsynced = 0
+	}
+
 	s, err := newSegment(l.Dir, offset, l.Config)
 	if err != nil {
 		return fmt.Errorf("create segment for log: %w", err)
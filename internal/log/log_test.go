@@ -1,10 +1,20 @@
 package log
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
 	api "github.com/huytran2000-hcmus/proglog/api/v1"
@@ -48,6 +58,101 @@ func TestLog(t *testing.T) {
 		testLogReader(t, log)
 		defer os.RemoveAll(log.Dir)
 	})
+
+	t.Run("open legacy segment", func(t *testing.T) {
+		log := createLog()
+		testLegacySegment(t, log)
+		defer os.RemoveAll(log.Dir)
+	})
+
+	t.Run("recover torn tail", func(t *testing.T) {
+		log := createLog()
+		testRecoverTornTail(t, log)
+		defer os.RemoveAll(log.Dir)
+	})
+
+	t.Run("recover unflushed records", func(t *testing.T) {
+		log := createLog()
+		testRecoverUnflushed(t, log)
+		defer os.RemoveAll(log.Dir)
+	})
+
+	t.Run("rebuild missing index", func(t *testing.T) {
+		log := createLog()
+		testRebuildMissingIndex(t, log)
+		defer os.RemoveAll(log.Dir)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		log := createLog()
+		testResetLog(t, log)
+		defer os.RemoveAll(log.Dir)
+	})
+}
+
+func TestLogSyncPolicy(t *testing.T) {
+	createLog := func(policy SyncPolicy) *Log {
+		dir, err := os.MkdirTemp(os.TempDir(), "log-sync-test")
+		testhelper.AssertNoError(t, err)
+
+		var c Config
+		c.Segment.MaxStoreBytes = 1024
+		c.Sync.Policy = policy
+		c.Sync.EveryN = 2
+		c.Sync.Interval = 10 * time.Millisecond
+
+		log, err := New(dir, c)
+		testhelper.AssertNoError(t, err)
+
+		return log
+	}
+
+	record := &api.Record{
+		Value: []byte("six figure job"),
+	}
+
+	onDisk := func(log *Log) bool {
+		fi, err := os.Stat(log.activeSegment.store.Name())
+		testhelper.RequireNoError(t, err)
+
+		return uint64(fi.Size()) == log.activeSegment.store.size
+	}
+
+	t.Run("always", func(t *testing.T) {
+		log := createLog(SyncAlways)
+		defer log.Remove()
+
+		_, err := log.Append(record)
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, true, onDisk(log))
+	})
+
+	t.Run("every n", func(t *testing.T) {
+		log := createLog(SyncEveryN)
+		defer log.Remove()
+
+		_, err := log.Append(record)
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, false, onDisk(log))
+
+		_, err = log.Append(record)
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, true, onDisk(log))
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		log := createLog(SyncInterval)
+		defer log.Remove()
+
+		_, err := log.Append(record)
+		testhelper.AssertNoError(t, err)
+		require.Eventually(t, func() bool {
+			log.mu.RLock()
+			defer log.mu.RUnlock()
+
+			return onDisk(log)
+		}, time.Second, 10*time.Millisecond)
+	})
 }
 
 func testAppendReadLog(t *testing.T, log *Log) {
@@ -103,6 +208,661 @@ func testRecreateLog(t *testing.T, log *Log) {
 	testhelper.AssertEqual(t, uint64(n), offset)
 }
 
+func TestLogAppendBatch(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "log-batch-test")
+	testhelper.RequireNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var c Config
+	c.Segment.MaxStoreBytes = 256
+
+	log, err := New(dir, c)
+	testhelper.RequireNoError(t, err)
+
+	_, err = log.Append(&api.Record{Value: []byte("first")})
+	testhelper.RequireNoError(t, err)
+
+	n := 20
+	batch := make([]*api.Record, n)
+	for i := range batch {
+		batch[i] = &api.Record{Value: []byte(fmt.Sprintf("six figure job %d", i))}
+	}
+
+	first, err := log.AppendBatch(batch)
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(1), first)
+
+	if len(log.segments) < 3 {
+		t.Fatalf("want the batch to span several segments, got %d", len(log.segments))
+	}
+
+	// a segment takes its part of the batch as one block
+	for _, s := range log.segments[1 : len(log.segments)-1] {
+		_, firstPos, err := s.index.Read(0)
+		testhelper.RequireNoError(t, err)
+		_, lastPos, err := s.index.Read(-1)
+		testhelper.RequireNoError(t, err)
+		testhelper.AssertEqual(t, firstPos, lastPos)
+	}
+
+	assertBatch := func(t *testing.T, log *Log) {
+		t.Helper()
+
+		for i, want := range batch {
+			got, err := log.Read(first + uint64(i))
+			testhelper.AssertNoError(t, err)
+			testhelper.AssertEqual(t, first+uint64(i), got.Offset)
+			testhelper.AssertEqual(t, want.Value, got.Value)
+		}
+	}
+	assertBatch(t, log)
+
+	t.Run("rebuild index of the active block", func(t *testing.T) {
+		active := log.activeSegment.baseOffset
+		err := log.Close()
+		testhelper.RequireNoError(t, err)
+
+		err = os.Remove(filepath.Join(dir, fmt.Sprintf("%d.index", active)))
+		testhelper.RequireNoError(t, err)
+
+		log, err = New(dir, c)
+		testhelper.RequireNoError(t, err)
+		defer log.Close()
+
+		assertBatch(t, log)
+
+		offset, err := log.Append(&api.Record{Value: []byte("last")})
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, first+uint64(n), offset)
+	})
+}
+
+func TestLogWait(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "log-wait-test")
+	testhelper.RequireNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	log, err := New(dir, Config{})
+	testhelper.RequireNoError(t, err)
+
+	_, err = log.Append(&api.Record{Value: []byte("six figure job")})
+	testhelper.RequireNoError(t, err)
+
+	ctx := context.Background()
+	err = log.Wait(ctx, 0)
+	testhelper.AssertNoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- log.Wait(ctx, 1)
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("want wait to block until offset 1 is appended, returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, err = log.Append(&api.Record{Value: []byte("six figure job")})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertNoError(t, <-done)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err = log.Wait(timeoutCtx, 2)
+	testhelper.AssertError(t, context.DeadlineExceeded, err)
+
+	go func() {
+		done <- log.Wait(ctx, 2)
+	}()
+
+	err = log.Close()
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertError(t, ErrClosed, <-done)
+}
+
+func TestLogRetention(t *testing.T) {
+	old := time.Now().Add(-2 * time.Hour)
+	createLog := func() *Log {
+		dir, err := os.MkdirTemp(os.TempDir(), "log-retention-test")
+		testhelper.AssertNoError(t, err)
+
+		var c Config
+		c.Segment.MaxStoreBytes = 32
+
+		log, err := New(dir, c)
+		testhelper.AssertNoError(t, err)
+
+		for i := 0; i < 5; i++ {
+			record := &api.Record{Value: []byte("six figure job")}
+			if i < 2 {
+				record.Timestamp = old.UnixNano()
+			}
+
+			_, err := log.Append(record)
+			testhelper.RequireNoError(t, err)
+		}
+
+		return log
+	}
+
+	assertExpired := func(t *testing.T, log *Log, lowest uint64) {
+		t.Helper()
+
+		offset, err := log.LowestOffset()
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, lowest, offset)
+
+		_, err = log.Read(0)
+		var outOfRangeErr api.OffsetOutOfRangeError
+		if !errors.As(err, &outOfRangeErr) {
+			t.Fatalf("expect OffsetOutOfRangeError, got %v", err)
+		}
+		testhelper.AssertEqual(t, lowest, outOfRangeErr.Lowest)
+
+		// clients get where to resume from without parsing the message
+		st := status.Convert(err)
+		testhelper.AssertEqual(t, codes.OutOfRange, st.Code())
+		var info *errdetails.ErrorInfo
+		for _, d := range st.Details() {
+			if d, ok := d.(*errdetails.ErrorInfo); ok {
+				info = d
+			}
+		}
+		require.NotNil(t, info)
+		testhelper.AssertEqual(t, api.ReasonOffsetExpired, info.Reason)
+		testhelper.AssertEqual(t, fmt.Sprint(lowest), info.Metadata[api.LowestOffsetMetadataKey])
+
+		_, err = log.Read(lowest)
+		testhelper.AssertNoError(t, err)
+	}
+
+	t.Run("max bytes", func(t *testing.T) {
+		log := createLog()
+		defer log.Remove()
+
+		segments := log.segments
+		log.Config.Retention.MaxBytes = segments[3].store.size + segments[4].store.size + segments[5].store.size
+
+		err := log.EnforceRetention()
+		testhelper.AssertNoError(t, err)
+		assertExpired(t, log, 3)
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		log := createLog()
+		defer log.Remove()
+
+		log.Config.Retention.MaxAge = time.Hour
+
+		err := log.EnforceRetention()
+		testhelper.AssertNoError(t, err)
+		assertExpired(t, log, 2)
+	})
+
+	t.Run("snapshot keeps removed segments", func(t *testing.T) {
+		log := createLog()
+		defer log.Remove()
+
+		r, err := log.Reader()
+		testhelper.RequireNoError(t, err)
+		defer r.Close()
+
+		log.Config.Retention.MaxBytes = 1
+		err = log.EnforceRetention()
+		testhelper.AssertNoError(t, err)
+
+		restoreDir, err := os.MkdirTemp(os.TempDir(), "log-retention-test")
+		testhelper.RequireNoError(t, err)
+		defer os.RemoveAll(restoreDir)
+
+		topics, err := NewTopics(restoreDir, Config{})
+		testhelper.RequireNoError(t, err)
+		defer topics.Close()
+
+		f := &fsm{topics: topics, groups: newGroups(), producers: newProducers(), txns: newTxns()}
+		err = f.Restore(r)
+		testhelper.RequireNoError(t, err)
+
+		record, err := topics.Read(DefaultTopic, 0, 0)
+		testhelper.RequireNoError(t, err)
+		testhelper.AssertEqual(t, uint64(0), record.Offset)
+	})
+
+	t.Run("keep active segment", func(t *testing.T) {
+		log := createLog()
+		defer log.Remove()
+
+		log.Config.Retention.MaxBytes = 1
+
+		err := log.EnforceRetention()
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, 1, len(log.segments))
+
+		offset, err := log.Append(&api.Record{Value: []byte("six figure job")})
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, uint64(5), offset)
+	})
+}
+
+func TestLogOffsetForTime(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "log-time-test")
+	testhelper.RequireNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var c Config
+	c.Segment.MaxStoreBytes = 256
+	c.Segment.TimeIndexIntervalBytes = 64
+
+	log, err := New(dir, c)
+	testhelper.RequireNoError(t, err)
+
+	base := time.Date(2023, time.November, 20, 9, 0, 0, 0, time.UTC)
+	n := 20
+	for i := 0; i < n; i++ {
+		_, err := log.Append(&api.Record{
+			Value:     []byte("six figure job"),
+			Timestamp: base.Add(time.Duration(i) * time.Second).UnixNano(),
+		})
+		testhelper.RequireNoError(t, err)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want uint64
+	}{
+		{name: "before first record", at: base.Add(-time.Hour), want: 0},
+		{name: "exact timestamp", at: base.Add(7 * time.Second), want: 7},
+		{name: "between records", at: base.Add(12*time.Second + time.Millisecond), want: 13},
+		{name: "after last record", at: base.Add(time.Hour), want: uint64(n)},
+	}
+
+	assertOffsets := func(t *testing.T, log *Log) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := log.OffsetForTime(tt.at)
+				testhelper.AssertNoError(t, err)
+				testhelper.AssertEqual(t, tt.want, got)
+			})
+		}
+	}
+
+	if len(log.segments) < 3 {
+		t.Fatalf("want the records spread over several segments, got %d", len(log.segments))
+	}
+	assertOffsets(t, log)
+
+	err = log.Close()
+	testhelper.RequireNoError(t, err)
+
+	log, err = New(dir, c)
+	testhelper.RequireNoError(t, err)
+	defer log.Close()
+
+	assertOffsets(t, log)
+}
+
+func TestLogCompactionTxns(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "log-compaction-txns-test")
+	testhelper.RequireNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	statuses := map[uint64]txnStatus{1: txnAborted, 2: txnOpen, 3: txnCommitted}
+	var c Config
+	c.Segment.MaxStoreBytes = 128
+	c.Compaction.txnStatus = func(id uint64) txnStatus {
+		return statuses[id]
+	}
+
+	log, err := New(dir, c)
+	testhelper.RequireNoError(t, err)
+	defer log.Close()
+
+	records := []*api.Record{
+		{Key: []byte("k"), Value: []byte("committed")},
+		{Key: []byte("k"), Value: []byte("aborted"), TxnId: 1},
+		{Key: []byte("k"), Value: []byte("open"), TxnId: 2},
+		{Key: []byte("j"), Value: []byte("committed"), TxnId: 3},
+		{Key: []byte("j"), Value: []byte("aborted"), TxnId: 1},
+	}
+	for _, record := range records {
+		_, err := log.Append(record)
+		testhelper.RequireNoError(t, err)
+	}
+
+	// the active segment isn't compacted
+	for log.activeSegment.baseOffset < uint64(len(records)) {
+		_, err := log.Append(&api.Record{Value: []byte("filler")})
+		testhelper.RequireNoError(t, err)
+	}
+
+	err = log.Compact()
+	testhelper.RequireNoError(t, err)
+
+	// the committed records of every key survive the newer records of
+	// transactions, the open transaction keeps its record and the aborted
+	// one loses its own
+	var offsets []uint64
+	for offset := uint64(0); offset < uint64(len(records)); {
+		record, err := log.Read(offset)
+		testhelper.RequireNoError(t, err)
+		if record.Offset >= uint64(len(records)) {
+			break
+		}
+		testhelper.AssertEqual(t, records[record.Offset].Value, record.Value)
+
+		offsets = append(offsets, record.Offset)
+		offset = record.Offset + 1
+	}
+	testhelper.AssertEqual(t, []uint64{0, 2, 3}, offsets)
+}
+
+func TestLogCompaction(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "log-compaction-test")
+	testhelper.RequireNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var c Config
+	c.Segment.MaxStoreBytes = 128
+
+	log, err := New(dir, c)
+	testhelper.RequireNoError(t, err)
+
+	records := []struct {
+		key   string
+		value string
+	}{
+		{key: "a", value: "a1"},
+		{key: "b", value: "b1"},
+		{value: "unkeyed"},
+		{key: "a", value: "a2"},
+		{key: "c", value: "c1"},
+		{key: "b"},
+		{key: "a", value: "a3"},
+		{key: "c", value: "c2"},
+		{value: "unkeyed"},
+		{key: "d", value: "d1"},
+	}
+	for _, r := range records {
+		record := &api.Record{Value: []byte(r.value)}
+		if r.key != "" {
+			record.Key = []byte(r.key)
+		}
+
+		_, err := log.Append(record)
+		testhelper.RequireNoError(t, err)
+	}
+
+	// the active segment isn't compacted
+	for log.activeSegment.baseOffset < uint64(len(records)) {
+		_, err := log.Append(&api.Record{Value: []byte("six figure job")})
+		testhelper.RequireNoError(t, err)
+	}
+
+	err = log.Compact()
+	testhelper.RequireNoError(t, err)
+
+	surviving := []uint64{2, 5, 6, 7, 8, 9}
+	assertCompacted := func(t *testing.T, log *Log) {
+		t.Helper()
+
+		lowest, err := log.LowestOffset()
+		testhelper.RequireNoError(t, err)
+
+		var offsets []uint64
+		for offset := lowest; offset < uint64(len(records)); {
+			record, err := log.Read(offset)
+			testhelper.RequireNoError(t, err)
+
+			want := records[record.Offset]
+			testhelper.AssertEqual(t, want.key, string(record.Key))
+			testhelper.AssertEqual(t, want.value, string(record.Value))
+
+			offsets = append(offsets, record.Offset)
+			offset = record.Offset + 1
+		}
+		testhelper.AssertEqual(t, surviving, offsets)
+
+		// a removed offset reads as the next surviving one
+		record, err := log.Read(3)
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, uint64(5), record.Offset)
+	}
+
+	assertCompacted(t, log)
+
+	t.Run("reopen", func(t *testing.T) {
+		err := log.Close()
+		testhelper.RequireNoError(t, err)
+
+		log, err = New(dir, c)
+		testhelper.RequireNoError(t, err)
+
+		assertCompacted(t, log)
+	})
+
+	t.Run("finish interrupted swap", func(t *testing.T) {
+		err := log.Close()
+		testhelper.RequireNoError(t, err)
+
+		// a compacted copy of the first segment whose swap was cut short
+		compacted := filepath.Join(dir, compactionDir)
+		err = os.MkdirAll(compacted, 0755)
+		testhelper.RequireNoError(t, err)
+
+		first := log.segments[0].baseOffset
+		for _, ext := range segmentExts {
+			name := fmt.Sprintf("%d%s", first, ext)
+			b, err := os.ReadFile(filepath.Join(dir, name))
+			testhelper.RequireNoError(t, err)
+
+			err = os.WriteFile(filepath.Join(compacted, name), b, 0644)
+			testhelper.RequireNoError(t, err)
+		}
+
+		err = os.WriteFile(filepath.Join(compacted, fmt.Sprintf("%d%s", first, swapExt)), nil, 0644)
+		testhelper.RequireNoError(t, err)
+
+		log, err = New(dir, c)
+		testhelper.RequireNoError(t, err)
+
+		_, err = os.Stat(compacted)
+		testhelper.AssertError(t, os.ErrNotExist, err)
+		assertCompacted(t, log)
+	})
+
+	t.Run("restore snapshot", func(t *testing.T) {
+		restoreDir, err := os.MkdirTemp(os.TempDir(), "log-compaction-test")
+		testhelper.RequireNoError(t, err)
+		defer os.RemoveAll(restoreDir)
+
+		topics, err := NewTopics(restoreDir, c)
+		testhelper.RequireNoError(t, err)
+		defer topics.Close()
+
+		r, err := log.Reader()
+		testhelper.RequireNoError(t, err)
+		defer r.Close()
+
+		f := &fsm{topics: topics, groups: newGroups(), producers: newProducers(), txns: newTxns()}
+		err = f.Restore(r)
+		testhelper.RequireNoError(t, err)
+
+		restored, err := topics.Log(DefaultTopic, 0)
+		testhelper.RequireNoError(t, err)
+		assertCompacted(t, restored)
+	})
+
+	t.Run("append while compacting", func(t *testing.T) {
+		done := make(chan error)
+		go func() {
+			var err error
+			for i := 0; i < 5 && err == nil; i++ {
+				err = log.Compact()
+			}
+			done <- err
+		}()
+
+		var last uint64
+		for i := 0; i < 100; i++ {
+			last, err = log.Append(&api.Record{Key: []byte("e"), Value: []byte(fmt.Sprintf("e%d", i))})
+			testhelper.RequireNoError(t, err)
+
+			_, err = log.Read(uint64(len(records)))
+			testhelper.RequireNoError(t, err)
+		}
+		testhelper.RequireNoError(t, <-done)
+
+		err = log.Compact()
+		testhelper.RequireNoError(t, err)
+
+		record, err := log.Read(last)
+		testhelper.RequireNoError(t, err)
+		testhelper.AssertEqual(t, "e99", string(record.Value))
+
+		// only the newest record of e is left
+		var keyed int
+		for offset := uint64(0); offset <= last; offset = record.Offset + 1 {
+			record, err = log.Read(offset)
+			testhelper.RequireNoError(t, err)
+			if string(record.Key) == "e" {
+				keyed++
+			}
+		}
+		testhelper.AssertEqual(t, 1, keyed)
+	})
+
+	err = log.Close()
+	testhelper.AssertNoError(t, err)
+}
+
+func TestLogCompression(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "log-compression-test")
+	testhelper.RequireNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var c Config
+	c.Segment.MaxStoreBytes = 256
+	c.Segment.Compression = CodecZstd
+
+	log, err := New(dir, c)
+	testhelper.RequireNoError(t, err)
+
+	want := &api.Record{Value: []byte(`{"event":"job.offered","salary":"six figure"}`)}
+	n := 10
+	for i := 0; i < n; i++ {
+		_, err := log.Append(want)
+		testhelper.RequireNoError(t, err)
+	}
+
+	assertRecords := func(t *testing.T, log *Log) {
+		t.Helper()
+
+		for i := uint64(0); i < uint64(n); i++ {
+			got, err := log.Read(i)
+			testhelper.AssertNoError(t, err)
+			testhelper.AssertEqual(t, i, got.Offset)
+			testhelper.AssertEqual(t, want.Value, got.Value)
+		}
+	}
+
+	err = log.Close()
+	testhelper.RequireNoError(t, err)
+
+	log, err = New(dir, c)
+	testhelper.RequireNoError(t, err)
+	defer log.Close()
+
+	assertRecords(t, log)
+
+	t.Run("restore snapshot without compression", func(t *testing.T) {
+		restoreDir, err := os.MkdirTemp(os.TempDir(), "log-compression-test")
+		testhelper.RequireNoError(t, err)
+		defer os.RemoveAll(restoreDir)
+
+		var restoreConfig Config
+		topics, err := NewTopics(restoreDir, restoreConfig)
+		testhelper.RequireNoError(t, err)
+		defer topics.Close()
+
+		r, err := log.Reader()
+		testhelper.RequireNoError(t, err)
+		defer r.Close()
+
+		f := &fsm{topics: topics, groups: newGroups(), producers: newProducers(), txns: newTxns()}
+		err = f.Restore(r)
+		testhelper.RequireNoError(t, err)
+
+		restored, err := topics.Log(DefaultTopic, 0)
+		testhelper.RequireNoError(t, err)
+		assertRecords(t, restored)
+	})
+}
+
+func TestLogEncryptedSnapshot(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "log-encryption-test")
+	testhelper.RequireNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var c Config
+	c.Segment.MaxStoreBytes = 256
+	c.Encryption.Keyring, err = NewKeyring(7, map[uint32][]byte{7: bytes.Repeat([]byte{7}, 32)})
+	testhelper.RequireNoError(t, err)
+
+	topics, err := NewTopics(dir, c)
+	testhelper.RequireNoError(t, err)
+	defer topics.Close()
+
+	want := []byte("six figure job")
+	n := 10
+	for i := 0; i < n; i++ {
+		_, err := topics.Append(DefaultTopic, 0, &api.Record{Value: want})
+		testhelper.RequireNoError(t, err)
+	}
+
+	snap, err := (&fsm{topics: topics, groups: newGroups(), producers: newProducers(), txns: newTxns()}).Snapshot()
+	testhelper.RequireNoError(t, err)
+
+	sink := &snapshotSink{}
+	err = snap.Persist(sink)
+	testhelper.RequireNoError(t, err)
+	if bytes.Contains(sink.Bytes(), want) {
+		t.Errorf("want the snapshot encrypted, found a record in plaintext")
+	}
+
+	restore := func(c Config) (*Topics, error) {
+		restoreDir, err := os.MkdirTemp(os.TempDir(), "log-encryption-test")
+		testhelper.RequireNoError(t, err)
+		t.Cleanup(func() { os.RemoveAll(restoreDir) })
+
+		restored, err := NewTopics(restoreDir, c)
+		testhelper.RequireNoError(t, err)
+		t.Cleanup(func() { restored.Close() })
+
+		return restored, (&fsm{topics: restored, groups: newGroups(), producers: newProducers(), txns: newTxns()}).Restore(io.NopCloser(bytes.NewReader(sink.Bytes())))
+	}
+
+	restored, err := restore(c)
+	testhelper.RequireNoError(t, err)
+	for i := uint64(0); i < uint64(n); i++ {
+		got, err := restored.Read(DefaultTopic, 0, i)
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, want, got.Value)
+	}
+
+	_, err = restore(Config{})
+	testhelper.AssertError(t, errNoKeyring, err)
+}
+
+type snapshotSink struct {
+	bytes.Buffer
+}
+
+func (s *snapshotSink) ID() string    { return "snapshot" }
+func (s *snapshotSink) Cancel() error { return nil }
+func (s *snapshotSink) Close() error  { return nil }
+
 func testLogReader(t *testing.T, log *Log) {
 	want := &api.Record{
 		Value: []byte("six figure job"),
@@ -116,16 +876,198 @@ func testLogReader(t *testing.T, log *Log) {
 	testhelper.AssertNoError(t, err)
 	testhelper.AssertEqual(t, want.Value, got.Value)
 
-	reader := log.Reader()
-	b, err := io.ReadAll(reader)
+	r, err := log.Reader()
+	testhelper.RequireNoError(t, err)
+	defer r.Close()
+
+	fr := &frameReader{r: r}
+	b, err := fr.Next()
 	testhelper.AssertNoError(t, err)
 
+	block, err := decodeBlock(fr.version, b)
+	testhelper.AssertNoError(t, err)
+	testhelper.AssertEqual(t, 1, len(block))
+
 	got = &api.Record{}
-	err = proto.Unmarshal(b[lenWidth:], got)
+	err = proto.Unmarshal(block[0], got)
+	testhelper.AssertNoError(t, err)
+	testhelper.AssertEqual(t, want.Value, got.Value)
+}
+
+func testLegacySegment(t *testing.T, log *Log) {
+	err := log.Close()
+	testhelper.RequireNoError(t, err)
+
+	want := &api.Record{
+		Value:  []byte("written before checksums"),
+		Offset: 0,
+	}
+	p, err := proto.Marshal(want)
+	testhelper.RequireNoError(t, err)
+
+	frame := make([]byte, lenWidth)
+	enc.PutUint64(frame, uint64(len(p)))
+	err = os.WriteFile(filepath.Join(log.Dir, "0.store"), append(frame, p...), 0644)
+	testhelper.RequireNoError(t, err)
+
+	entry := make([]byte, entryWidth)
+	err = os.WriteFile(filepath.Join(log.Dir, "0.index"), entry, 0644)
+	testhelper.RequireNoError(t, err)
+
+	log, err = New(log.Dir, log.Config)
+	testhelper.RequireNoError(t, err)
+	defer log.Close()
+
+	got, err := log.Read(0)
+	testhelper.AssertNoError(t, err)
+	testhelper.AssertEqual(t, want.Value, got.Value)
+
+	offset, err := log.Append(&api.Record{Value: []byte("written with checksums")})
+	testhelper.AssertNoError(t, err)
+	testhelper.AssertEqual(t, uint64(1), offset)
+	testhelper.AssertEqual(t, storeVersionLegacy, log.segments[0].store.version)
+	testhelper.AssertEqual(t, storeVersion, log.segments[1].store.version)
+}
+
+func testRecoverTornTail(t *testing.T, log *Log) {
+	err := log.Close()
+	testhelper.RequireNoError(t, err)
+
+	log.Config.Segment.MaxStoreBytes = 1024
+	log, err = New(log.Dir, log.Config)
+	testhelper.RequireNoError(t, err)
+
+	want := &api.Record{
+		Value: []byte("six figure job"),
+	}
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(want)
+		testhelper.RequireNoError(t, err)
+	}
+	err = log.Close()
+	testhelper.RequireNoError(t, err)
+
+	storeFile, err := os.OpenFile(filepath.Join(log.Dir, "0.store"), os.O_WRONLY|os.O_APPEND, 0644)
+	testhelper.RequireNoError(t, err)
+	frame := make([]byte, lenWidth+crcWidth)
+	enc.PutUint64(frame, 100)
+	_, err = storeFile.Write(append(frame, []byte("torn")...))
+	testhelper.RequireNoError(t, err)
+	testhelper.RequireNoError(t, storeFile.Close())
+
+	err = os.Truncate(filepath.Join(log.Dir, "0.index"), int64(log.Config.Segment.MaxIndexBytes))
+	testhelper.RequireNoError(t, err)
+
+	log, err = New(log.Dir, log.Config)
+	testhelper.RequireNoError(t, err)
+	defer log.Close()
+
+	offset, err := log.HighestOffset()
+	testhelper.AssertNoError(t, err)
+	testhelper.AssertEqual(t, uint64(2), offset)
+
+	offset, err = log.Append(want)
+	testhelper.AssertNoError(t, err)
+	testhelper.AssertEqual(t, uint64(3), offset)
+
+	for i := uint64(0); i <= offset; i++ {
+		got, err := log.Read(i)
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, want.Value, got.Value)
+	}
+}
+
+func testRecoverUnflushed(t *testing.T, log *Log) {
+	err := log.Close()
+	testhelper.RequireNoError(t, err)
+
+	log.Config.Segment.MaxStoreBytes = 1024
+	log, err = New(log.Dir, log.Config)
+	testhelper.RequireNoError(t, err)
+
+	want := &api.Record{
+		Value: []byte("six figure job"),
+	}
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(want)
+		testhelper.RequireNoError(t, err)
+	}
+
+	// the records are still in the store's buffer when the process dies
+	crashed := log
+	defer crashed.activeSegment.index.file.Close()
+	defer crashed.activeSegment.store.file.Close()
+
+	log, err = New(crashed.Dir, crashed.Config)
+	testhelper.RequireNoError(t, err)
+	defer log.Close()
+
+	_, err = log.Read(0)
+	if !errors.As(err, &api.OffsetOutOfRangeError{}) {
+		t.Errorf("expect OffsetOutOfRangeError, got %v", err)
+	}
+
+	offset, err := log.Append(want)
+	testhelper.AssertNoError(t, err)
+	testhelper.AssertEqual(t, uint64(0), offset)
+
+	got, err := log.Read(offset)
 	testhelper.AssertNoError(t, err)
 	testhelper.AssertEqual(t, want.Value, got.Value)
 }
 
+func testRebuildMissingIndex(t *testing.T, log *Log) {
+	err := log.Close()
+	testhelper.RequireNoError(t, err)
+
+	log.Config.Segment.MaxStoreBytes = 1024
+	log, err = New(log.Dir, log.Config)
+	testhelper.RequireNoError(t, err)
+
+	want := &api.Record{
+		Value: []byte("six figure job"),
+	}
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(want)
+		testhelper.RequireNoError(t, err)
+	}
+	err = log.Close()
+	testhelper.RequireNoError(t, err)
+
+	err = os.Remove(filepath.Join(log.Dir, "0.index"))
+	testhelper.RequireNoError(t, err)
+
+	log, err = New(log.Dir, log.Config)
+	testhelper.RequireNoError(t, err)
+	defer log.Close()
+
+	for i := uint64(0); i < 3; i++ {
+		got, err := log.Read(i)
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, i, got.Offset)
+		testhelper.AssertEqual(t, want.Value, got.Value)
+	}
+}
+
+func testResetLog(t *testing.T, log *Log) {
+	_, err := log.Append(&api.Record{Value: []byte("six figure job")})
+	testhelper.RequireNoError(t, err)
+
+	log.Config.Segment.InitialOffset = 10
+	err = log.Reset()
+	testhelper.RequireNoError(t, err)
+	defer log.Close()
+
+	_, err = log.Read(0)
+	if !errors.As(err, &api.OffsetOutOfRangeError{}) {
+		t.Errorf("expect OffsetOutOfRangeError, got %v", err)
+	}
+
+	offset, err := log.Append(&api.Record{Value: []byte("six figure job")})
+	testhelper.AssertNoError(t, err)
+	testhelper.AssertEqual(t, uint64(10), offset)
+}
+
 func testTruncateLog(t *testing.T, log *Log) {
 	n := 2
 	want := &api.Record{
@@ -0,0 +1,197 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+)
+
+// OffsetsTopic is the internal topic the committed offsets of the consumer
+// groups are kept in. Its records are keyed by group, topic and partition,
+// so compaction keeps the newest commit of each, and a keyed record without
+// a value drops the commit.
+const OffsetsTopic = "__consumer_offsets"
+
+type offsetKey struct {
+	group     string
+	topic     string
+	partition uint32
+}
+
+// offsetsConfig returns the config of the offsets topic. Its records are the
+// only copy of the committed offsets, so they never expire, and it's always
+// compacted down to the newest commit of each key.
+func offsetsConfig(c Config) Config {
+	c.Retention.MaxAge = 0
+	c.Retention.MaxBytes = 0
+	c.Compaction.Enabled = true
+
+	return c
+}
+
+func (k offsetKey) bytes() []byte {
+	return []byte(strings.Join([]string{k.group, k.topic, strconv.FormatUint(uint64(k.partition), 10)}, "\x00"))
+}
+
+// CommitOffset stores offset as the next offset the group consumes from the
+// partition of the topic. The record storing it gets the timestamp, in Unix
+// nanoseconds.
+func (t *Topics) CommitOffset(group, topic string, partition uint32, offset uint64, timestamp int64) error {
+	topic = topicOrDefault(topic)
+	err := validateGroup(group)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.Log(topic, partition)
+	if err != nil {
+		return err
+	}
+
+	value, err := proto.Marshal(&api.CommitOffsetRequest{
+		Group:     group,
+		Topic:     topic,
+		Partition: partition,
+		Offset:    offset,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal committed offset: %w", err)
+	}
+
+	key := offsetKey{group: group, topic: topic, partition: partition}
+	l, err := t.Log(OffsetsTopic, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.Append(&api.Record{Key: key.bytes(), Value: value, Timestamp: timestamp})
+	if err != nil {
+		return fmt.Errorf("append committed offset: %w", err)
+	}
+
+	t.offsetsMu.Lock()
+	t.offsets[key] = offset
+	t.offsetsMu.Unlock()
+
+	return nil
+}
+
+// CommittedOffset returns the offset the group last committed for the
+// partition of the topic.
+func (t *Topics) CommittedOffset(group, topic string, partition uint32) (uint64, error) {
+	key := offsetKey{group: group, topic: topicOrDefault(topic), partition: partition}
+
+	t.offsetsMu.RLock()
+	defer t.offsetsMu.RUnlock()
+
+	offset, ok := t.offsets[key]
+	if !ok {
+		return 0, api.OffsetNotCommittedError{Group: group, Topic: key.topic, Partition: partition}
+	}
+
+	return offset, nil
+}
+
+// dropOffsets removes the offsets committed for the topic, with a tombstone
+// for each so they stay removed once the offsets are loaded again. The
+// tombstones get the timestamp, in Unix nanoseconds.
+func (t *Topics) dropOffsets(l *Log, topic string, timestamp int64) error {
+	t.offsetsMu.Lock()
+	defer t.offsetsMu.Unlock()
+
+	// every replica appends the tombstones in the same order
+	var keys []offsetKey
+	for key := range t.offsets {
+		if key.topic == topic {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i].bytes(), keys[j].bytes()) < 0
+	})
+
+	for _, key := range keys {
+		_, err := l.Append(&api.Record{Key: key.bytes(), Timestamp: timestamp})
+		if err != nil {
+			return fmt.Errorf("append committed offset tombstone: %w", err)
+		}
+		delete(t.offsets, key)
+	}
+
+	return nil
+}
+
+// loadOffsets reads the committed offsets from the records of the offsets
+// topic.
+func (t *Topics) loadOffsets() error {
+	l, err := t.Log(OffsetsTopic, 0)
+	if err != nil {
+		return err
+	}
+
+	offset, err := l.LowestOffset()
+	if err != nil {
+		return err
+	}
+
+	offsets := make(map[offsetKey]uint64)
+	for {
+		record, err := l.Read(offset)
+		if errors.As(err, &api.OffsetOutOfRangeError{}) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read committed offset: %w", err)
+		}
+		offset = record.Offset + 1
+
+		if len(record.Value) == 0 {
+			key, ok := parseOffsetKey(record.Key)
+			if ok {
+				delete(offsets, key)
+			}
+			continue
+		}
+
+		var req api.CommitOffsetRequest
+		err = proto.Unmarshal(record.Value, &req)
+		if err != nil {
+			return fmt.Errorf("unmarshal committed offset: %w", err)
+		}
+
+		offsets[offsetKey{group: req.Group, topic: req.Topic, partition: req.Partition}] = req.Offset
+	}
+
+	t.offsetsMu.Lock()
+	t.offsets = offsets
+	t.offsetsMu.Unlock()
+
+	return nil
+}
+
+func parseOffsetKey(b []byte) (offsetKey, bool) {
+	parts := strings.Split(string(b), "\x00")
+	if len(parts) != 3 {
+		return offsetKey{}, false
+	}
+
+	partition, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return offsetKey{}, false
+	}
+
+	return offsetKey{group: parts[0], topic: parts[1], partition: uint32(partition)}, true
+}
+
+// IsInternalTopic reports whether the topic is one the node keeps for
+// itself.
+func IsInternalTopic(name string) bool {
+	return api.IsInternalTopic(name)
+}
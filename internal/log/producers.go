@@ -0,0 +1,200 @@
+package log
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+)
+
+// producerWindow is how many of the latest appends of a producer to a
+// partition are remembered, so a retried append among them gets its
+// original offset back.
+const producerWindow = 5
+
+// producers holds the idempotent producers and their latest appends. It is
+// state of the FSM, so every replica hands out the same producer IDs and
+// detects the same duplicates.
+type producers struct {
+	mu    sync.Mutex
+	state producersState
+}
+
+// producersState is kept in the snapshots as JSON.
+type producersState struct {
+	NextID    uint64               `json:"next_id"`
+	Producers map[uint64]*producer `json:"producers"`
+}
+
+type producer struct {
+	Epoch uint32 `json:"epoch"`
+	// Partitions holds the appends of the producer by topic and partition.
+	Partitions map[string]*producerPartition `json:"partitions"`
+}
+
+// producerPartition holds the latest appends of a producer to a partition.
+// The sequence of an append is the one of its first record.
+type producerPartition struct {
+	LastSequence uint64           `json:"last_sequence"`
+	Appends      []producerAppend `json:"appends"`
+}
+
+type producerAppend struct {
+	Sequence uint64 `json:"sequence"`
+	Offset   uint64 `json:"offset"`
+}
+
+func newProducers() *producers {
+	return &producers{state: producersState{
+		NextID:    1,
+		Producers: make(map[uint64]*producer),
+	}}
+}
+
+// init hands out a new producer ID, or the next epoch of the producer ID
+// when it is given.
+func (p *producers) init(id uint64) (*api.InitProducerResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id == 0 {
+		id = p.state.NextID
+		p.state.NextID++
+		p.state.Producers[id] = &producer{Partitions: make(map[string]*producerPartition)}
+
+		return &api.InitProducerResponse{ProducerId: id}, nil
+	}
+
+	prod, ok := p.state.Producers[id]
+	if !ok {
+		return nil, api.UnknownProducerError{ProducerID: id}
+	}
+
+	// the sequences of the new epoch start again from zero
+	prod.Epoch++
+	prod.Partitions = make(map[string]*producerPartition)
+
+	return &api.InitProducerResponse{ProducerId: id, ProducerEpoch: prod.Epoch}, nil
+}
+
+// lookup returns the offset the append was first appended at if it is a
+// duplicate of one of the latest appends of the producer to the partition.
+func (p *producers) lookup(id uint64, epoch uint32, topic string, partition uint32, sequence uint64) (uint64, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	prod, err := p.currentLocked(id, epoch)
+	if err != nil {
+		return 0, false, err
+	}
+
+	part, ok := prod.Partitions[partitionKey(topic, partition)]
+	if !ok || sequence > part.LastSequence {
+		return 0, false, nil
+	}
+
+	for _, a := range part.Appends {
+		if a.Sequence == sequence {
+			return a.Offset, true, nil
+		}
+	}
+
+	return 0, false, api.DuplicateSequenceError{ProducerID: id, Sequence: sequence}
+}
+
+// check returns an error unless the producer exists and the epoch is its
+// current one.
+func (p *producers) check(id uint64, epoch uint32) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := p.currentLocked(id, epoch)
+	return err
+}
+
+func (p *producers) currentLocked(id uint64, epoch uint32) (*producer, error) {
+	prod, ok := p.state.Producers[id]
+	if !ok {
+		return nil, api.UnknownProducerError{ProducerID: id}
+	}
+
+	if epoch != prod.Epoch {
+		return nil, api.ProducerFencedError{ProducerID: id, Epoch: epoch, Current: prod.Epoch}
+	}
+
+	return prod, nil
+}
+
+// record remembers the append of the producer to the partition.
+func (p *producers) record(id uint64, topic string, partition uint32, sequence, offset uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	prod, ok := p.state.Producers[id]
+	if !ok {
+		return
+	}
+
+	if prod.Partitions == nil {
+		prod.Partitions = make(map[string]*producerPartition)
+	}
+
+	key := partitionKey(topic, partition)
+	part, ok := prod.Partitions[key]
+	if !ok {
+		part = &producerPartition{}
+		prod.Partitions[key] = part
+	}
+
+	part.LastSequence = sequence
+	part.Appends = append(part.Appends, producerAppend{Sequence: sequence, Offset: offset})
+	if len(part.Appends) > producerWindow {
+		part.Appends = part.Appends[len(part.Appends)-producerWindow:]
+	}
+}
+
+func (p *producers) marshal() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return json.Marshal(p.state)
+}
+
+func (p *producers) unmarshal(b []byte) error {
+	state := producersState{
+		NextID:    1,
+		Producers: make(map[uint64]*producer),
+	}
+	if len(b) > 0 {
+		err := json.Unmarshal(b, &state)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	p.state = state
+	p.mu.Unlock()
+
+	return nil
+}
+
+func partitionKey(topic string, partition uint32) string {
+	return topicOrDefault(topic) + "/" + strconv.FormatUint(uint64(partition), 10)
+}
+
+func parsePartitionKey(key string) (string, uint32, bool) {
+	i := strings.LastIndexByte(key, '/')
+	if i < 0 {
+		return "", 0, false
+	}
+
+	partition, err := strconv.ParseUint(key[i+1:], 10, 32)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return key[:i], uint32(partition), true
+}
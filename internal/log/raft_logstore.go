@@ -1,6 +1,8 @@
 package log
 
 import (
+	"time"
+
 	"github.com/hashicorp/raft"
 
 	api "github.com/huytran2000-hcmus/proglog/api/v1"
@@ -39,6 +41,7 @@ func (l *logStore) GetLog(index uint64, out *raft.Log) error {
 	out.Index = in.Offset
 	out.Type = raft.LogType(in.Type)
 	out.Term = in.Term
+	out.AppendedAt = time.Unix(0, in.Timestamp)
 
 	return nil
 }
@@ -48,16 +51,22 @@ func (l *logStore) StoreLog(record *raft.Log) error {
 }
 
 func (l *logStore) StoreLogs(records []*raft.Log) error {
-	for _, record := range records {
-		if _, err := l.Append(&api.Record{
+	batch := make([]*api.Record, len(records))
+	for i, record := range records {
+		batch[i] = &api.Record{
 			Value: record.Data,
 			Term:  record.Term,
 			Type:  uint32(record.Type),
-		}); err != nil {
-			return err
+		}
+		// keep the time the leader appended the log, which the FSM
+		// stamps the internal records with
+		if !record.AppendedAt.IsZero() {
+			batch[i].Timestamp = record.AppendedAt.UnixNano()
 		}
 	}
-	return nil
+
+	_, err := l.AppendBatch(batch)
+	return err
 }
 
 func (l *logStore) DeleteRange(min, max uint64) error {
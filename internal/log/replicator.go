@@ -6,13 +6,19 @@ import (
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	api "github.com/huytran2000-hcmus/proglog/api/v1"
 )
 
 type Replicator struct {
-	DialOpts     []grpc.DialOption
-	LocalServer  api.LogClient
+	DialOpts    []grpc.DialOption
+	LocalServer api.LogClient
+	// Group is the consumer group the replicator commits its offsets on the
+	// servers it replicates as. It resumes from the committed offsets when
+	// set, and replicates from the start otherwise.
+	Group        string
 	logger       *zap.Logger
 	mu           sync.Mutex
 	closeServers map[string]chan struct{}
@@ -82,8 +88,18 @@ func (rt *Replicator) replicate(addr string, leave chan struct{}) {
 	client := api.NewLogClient(cc)
 
 	ctx := context.Background()
+	var offset uint64
+	if rt.Group != "" {
+		res, err := client.FetchCommittedOffset(ctx, &api.FetchCommittedOffsetRequest{Group: rt.Group})
+		if err == nil {
+			offset = res.Offset
+		} else if status.Code(err) != codes.NotFound {
+			rt.logError(err, "failed to fetch committed offset", addr)
+		}
+	}
+
 	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{
-		Offset: 0,
+		Offset: offset,
 	})
 	if err != nil {
 		rt.logError(err, "failed to create consume stream", addr)
@@ -116,6 +132,17 @@ func (rt *Replicator) replicate(addr string, leave chan struct{}) {
 			_, err := rt.LocalServer.Produce(ctx, req)
 			if err != nil {
 				rt.logError(err, "failed to produce", addr)
+				continue
+			}
+
+			if rt.Group != "" {
+				_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{
+					Group:  rt.Group,
+					Offset: rec.Offset + 1,
+				})
+				if err != nil {
+					rt.logError(err, "failed to commit offset", addr)
+				}
 			}
 		}
 	}
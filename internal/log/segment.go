@@ -1,11 +1,13 @@
 package log
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 
@@ -15,8 +17,17 @@ import (
 type segment struct {
 	store                  *store
 	index                  *index
+	timeIndex              *timeIndex
 	baseOffset, nextOffset uint64
 	config                 Config
+
+	// maxTimestamp is the newest record timestamp in the segment and
+	// maxTimestampOff the relative offset of the record carrying it.
+	maxTimestamp    int64
+	maxTimestampOff uint32
+	// unindexedBytes counts the store bytes appended since the last time
+	// index entry.
+	unindexedBytes uint64
 }
 
 func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
@@ -33,7 +44,7 @@ func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 		return nil, fmt.Errorf("create store file: %w", err)
 	}
 
-	s.store, err = newStore(storeFile)
+	s.store, err = newStore(storeFile, c)
 	if err != nil {
 		return nil, fmt.Errorf("create store: %w", err)
 	}
@@ -49,6 +60,24 @@ func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 		return nil, fmt.Errorf("create store: %w", err)
 	}
 
+	timeIndexFile, err := os.OpenFile(
+		path.Join(dir, fmt.Sprintf("%d%s", baseOffset, ".timeindex")),
+		os.O_RDWR|os.O_CREATE|os.O_APPEND,
+		0644)
+	if err != nil {
+		return nil, fmt.Errorf("create time index file: %w", err)
+	}
+
+	s.timeIndex, err = newTimeIndex(timeIndexFile)
+	if err != nil {
+		return nil, fmt.Errorf("create time index: %w", err)
+	}
+
+	if last, ok := s.timeIndex.Last(); ok {
+		s.maxTimestamp = last.timestamp
+		s.maxTimestampOff = last.off
+	}
+
 	off, _, err := s.index.Read(-1)
 	if err != nil {
 		switch {
@@ -65,48 +94,279 @@ func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 }
 
 func (s *segment) Append(record *api.Record) (offset uint64, err error) {
-	cur := s.nextOffset
-	record.Offset = cur
+	_, err = s.AppendBatch([]*api.Record{record})
+	if err != nil {
+		return 0, err
+	}
+
+	return record.Offset, nil
+}
+
+// AppendBatch appends as many of the records as fit in the segment as one
+// block and returns how many it appended. The first record is appended even
+// if it overflows MaxStoreBytes, so a batch always makes progress.
+func (s *segment) AppendBatch(records []*api.Record) (int, error) {
+	free := (uint64(len(s.index.mmap)) - s.index.size) / entryWidth
+	if free == 0 {
+		return 0, fmt.Errorf("write index: %w", io.EOF)
+	}
+
+	size := s.store.size + lenWidth + crcWidth + attrsWidth
+	block := make([][]byte, 0, min(uint64(len(records)), free))
+	for _, record := range records {
+		if uint64(len(block)) == free {
+			break
+		}
+
+		record.Offset = s.nextOffset + uint64(len(block))
+		p, err := proto.Marshal(record)
+		if err != nil {
+			return 0, fmt.Errorf("marshal record: %w", err)
+		}
+
+		size += uint64(len(binary.AppendUvarint(nil, uint64(len(p)))) + len(p))
+		if len(block) > 0 && size > s.config.Segment.MaxStoreBytes {
+			break
+		}
+
+		block = append(block, p)
+	}
+
+	err := s.writeBlock(records[:len(block)], block)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(block), nil
+}
+
+// write appends the record keeping its offset, which must not be lower than
+// the next offset of the segment. Compaction and restoring a snapshot of a
+// compacted log leave gaps between offsets.
+func (s *segment) write(record *api.Record) error {
+	if record.Offset < s.nextOffset {
+		return fmt.Errorf("write offset %d before next offset %d", record.Offset, s.nextOffset)
+	}
+
 	p, err := proto.Marshal(record)
 	if err != nil {
-		return 0, fmt.Errorf("marshal record: %w", err)
+		return fmt.Errorf("marshal record: %w", err)
 	}
 
-	_, pos, err := s.store.Append(p)
+	return s.writeBlock([]*api.Record{record}, [][]byte{p})
+}
+
+// writeBlock appends the marshaled records as one block of the store and
+// indexes every record at the position of the block.
+func (s *segment) writeBlock(records []*api.Record, block [][]byte) error {
+	n, pos, err := s.store.Append(encodeBlock(block))
 	if err != nil {
-		return 0, fmt.Errorf("append to store: %w", err)
+		return fmt.Errorf("append to store: %w", err)
+	}
+
+	for i, record := range records {
+		relOff := uint32(record.Offset - s.baseOffset)
+		err = s.index.Write(relOff, pos)
+		if err != nil {
+			return fmt.Errorf("write index: %w", err)
+		}
+
+		// the block's bytes count once, towards its last record
+		var written uint64
+		if i == len(records)-1 {
+			written = n
+		}
+
+		err = s.indexTimestamp(record.Timestamp, relOff, written)
+		if err != nil {
+			return fmt.Errorf("write time index: %w", err)
+		}
+		s.nextOffset = record.Offset + 1
 	}
 
-	err = s.index.Write(
-		uint32(s.nextOffset-s.baseOffset),
-		pos,
-	)
+	return nil
+}
+
+// indexTimestamp tracks the newest timestamp of the segment and adds it to
+// the time index once enough bytes were appended since the last entry.
+func (s *segment) indexTimestamp(timestamp int64, off uint32, n uint64) error {
+	if timestamp > s.maxTimestamp {
+		s.maxTimestamp = timestamp
+		s.maxTimestampOff = off
+	}
+
+	s.unindexedBytes += n
+	if s.unindexedBytes < s.config.Segment.TimeIndexIntervalBytes {
+		return nil
+	}
+
+	return s.writeTimeIndex()
+}
+
+func (s *segment) writeTimeIndex() error {
+	if s.maxTimestamp == 0 {
+		return nil
+	}
+
+	last, ok := s.timeIndex.Last()
+	if ok && last.timestamp >= s.maxTimestamp {
+		return nil
+	}
+
+	err := s.timeIndex.Write(s.maxTimestamp, s.maxTimestampOff)
 	if err != nil {
-		return 0, fmt.Errorf("write index: %w", err)
+		return err
+	}
+	s.unindexedBytes = 0
+
+	return nil
+}
+
+// OffsetForTime returns the first offset in the segment whose record is not
+// older than timestamp.
+func (s *segment) OffsetForTime(timestamp int64) (uint64, bool, error) {
+	if s.maxTimestamp < timestamp {
+		return 0, false, nil
+	}
+
+	offset := s.baseOffset
+	if entry, ok := s.timeIndex.Lookup(timestamp); ok {
+		offset = s.baseOffset + uint64(entry.off) + 1
+	}
+
+	for offset < s.nextOffset {
+		record, err := s.Read(offset)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, false, err
+		}
+
+		if record.Timestamp >= timestamp {
+			return record.Offset, true, nil
+		}
+		offset = record.Offset + 1
 	}
-	s.nextOffset++
 
-	return cur, nil
+	return 0, false, nil
 }
 
+// Read returns the record at offset, or the first record after it if the
+// offset was compacted away. io.EOF is returned if no record is left at or
+// after the offset.
 func (s *segment) Read(offset uint64) (*api.Record, error) {
-	_, pos, err := s.index.Read(int64(offset - s.baseOffset))
+	_, pos, err := s.index.Find(uint32(offset - s.baseOffset))
 	if err != nil {
 		return nil, fmt.Errorf("read index: %w", err)
 	}
 
+	return s.readAt(offset, pos)
+}
+
+func (s *segment) readAt(offset, pos uint64) (*api.Record, error) {
+	records, err := s.readBlock(pos)
+	if err != nil {
+		var corruptErr api.CorruptRecordError
+		if errors.As(err, &corruptErr) {
+			corruptErr.Offset = offset
+			return nil, corruptErr
+		}
+
+		return nil, err
+	}
+
+	for _, record := range records {
+		if record.Offset >= offset {
+			return record, nil
+		}
+	}
+
+	return nil, api.CorruptRecordError{Offset: offset, Pos: pos}
+}
+
+// readBlock returns the records of the block stored at pos.
+func (s *segment) readBlock(pos uint64) ([]*api.Record, error) {
 	p, err := s.store.Read(pos)
 	if err != nil {
+		var corruptErr api.CorruptRecordError
+		if errors.As(err, &corruptErr) {
+			return nil, corruptErr
+		}
+
 		return nil, fmt.Errorf("read from store: %w", err)
 	}
 
-	var record api.Record
-	err = proto.Unmarshal(p, &record)
+	block, err := decodeBlock(s.store.version, p)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal protobuf")
+		return nil, api.CorruptRecordError{Pos: pos}
+	}
+
+	records := make([]*api.Record, len(block))
+	for i, b := range block {
+		records[i] = &api.Record{}
+		err = proto.Unmarshal(b, records[i])
+		if err != nil {
+			return nil, api.CorruptRecordError{Pos: pos}
+		}
 	}
 
-	return &record, nil
+	return records, nil
+}
+
+// forEach calls fn with every record of the segment in offset order.
+func (s *segment) forEach(fn func(*api.Record) error) error {
+	var block []*api.Record
+	var blockPos uint64
+	for i := int64(0); uint64(i) < s.index.size/entryWidth; i++ {
+		off, pos, err := s.index.Read(i)
+		if err != nil {
+			return fmt.Errorf("read index: %w", err)
+		}
+
+		if block == nil || pos != blockPos {
+			block, err = s.readBlock(pos)
+			if err != nil {
+				return err
+			}
+			blockPos = pos
+		}
+
+		offset := s.baseOffset + uint64(off)
+		var record *api.Record
+		for _, r := range block {
+			if r.Offset == offset {
+				record = r
+				break
+			}
+		}
+
+		if record == nil {
+			return api.CorruptRecordError{Offset: offset, Pos: pos}
+		}
+
+		err = fn(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newestTimestamp returns the newest record timestamp of the segment, or
+// when it was last written to if its records predate timestamps.
+func (s *segment) newestTimestamp() (time.Time, error) {
+	if s.maxTimestamp != 0 {
+		return time.Unix(0, s.maxTimestamp), nil
+	}
+
+	fi, err := os.Stat(s.store.Name())
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return fi.ModTime(), nil
 }
 
 func (s *segment) InRange(offset uint64) bool {
@@ -119,7 +379,100 @@ func (s *segment) LessThan(offset uint64) bool {
 
 func (s *segment) IsMaxed() bool {
 	return s.store.size >= s.config.Segment.MaxStoreBytes ||
-		s.index.size >= s.config.Segment.MaxIndexBytes
+		s.index.size+entryWidth > s.config.Segment.MaxIndexBytes
+}
+
+// recover truncates the store to its last complete record and rebuilds the
+// index from the store, dropping the torn tail a crash may have left behind.
+func (s *segment) recover() error {
+	positions, end, err := s.store.scan()
+	if err != nil {
+		return fmt.Errorf("scan store: %w", err)
+	}
+
+	err = s.store.truncate(end)
+	if err != nil {
+		return fmt.Errorf("truncate store: %w", err)
+	}
+
+	err = s.index.rebuild(positions, func(pos uint64) ([]uint32, error) {
+		records, err := s.readBlock(pos)
+		if err != nil {
+			return nil, err
+		}
+
+		offs := make([]uint32, len(records))
+		for i, record := range records {
+			offs[i] = uint32(record.Offset - s.baseOffset)
+		}
+
+		return offs, nil
+	})
+	if err != nil {
+		return fmt.Errorf("rebuild index: %w", err)
+	}
+
+	s.nextOffset = s.baseOffset
+	if off, _, err := s.index.Read(-1); err == nil {
+		s.nextOffset = s.baseOffset + uint64(off) + 1
+	}
+
+	err = s.timeIndex.truncate(uint32(s.nextOffset - s.baseOffset))
+	if err != nil {
+		return fmt.Errorf("truncate time index: %w", err)
+	}
+
+	// the records appended since the last time index entry may hold a newer
+	// timestamp
+	s.maxTimestamp, s.maxTimestampOff = 0, 0
+	offset := s.baseOffset
+	if last, ok := s.timeIndex.Last(); ok {
+		s.maxTimestamp, s.maxTimestampOff = last.timestamp, last.off
+		offset += uint64(last.off) + 1
+	}
+
+	for offset < s.nextOffset {
+		record, err := s.Read(offset)
+		if err != nil {
+			return fmt.Errorf("read record %d: %w", offset, err)
+		}
+
+		if record.Timestamp > s.maxTimestamp {
+			s.maxTimestamp = record.Timestamp
+			s.maxTimestampOff = uint32(record.Offset - s.baseOffset)
+		}
+		offset = record.Offset + 1
+	}
+
+	return nil
+}
+
+// seal flushes the segment to disk once it is no longer the active segment,
+// so that only the active segment needs recovery after a crash.
+func (s *segment) seal() error {
+	err := s.store.Sync()
+	if err != nil {
+		return fmt.Errorf("sync store: %w", err)
+	}
+
+	err = s.index.seal()
+	if err != nil {
+		return fmt.Errorf("seal index: %w", err)
+	}
+
+	// the last time index entry carries the newest timestamp of a sealed
+	// segment
+	err = s.writeTimeIndex()
+	if err != nil {
+		return fmt.Errorf("write time index: %w", err)
+	}
+
+	err = s.timeIndex.Sync()
+	if err != nil {
+		return fmt.Errorf("sync time index: %w", err)
+	}
+
+	return nil
 }
 
 func (s *segment) Remove() error {
@@ -138,6 +491,11 @@ func (s *segment) Remove() error {
 		return fmt.Errorf("remove index: %w", err)
 	}
 
+	err = s.timeIndex.Remove()
+	if err != nil {
+		return fmt.Errorf("remove time index: %w", err)
+	}
+
 	return nil
 }
 
@@ -152,9 +510,52 @@ func (s *segment) Close() error {
 		return fmt.Errorf("close index: %w", err)
 	}
 
+	err = s.timeIndex.Close()
+	if err != nil {
+		return fmt.Errorf("close time index: %w", err)
+	}
+
 	return nil
 }
 
+// encodeBlock packs the records appended together into the payload of one
+// store frame, each record prefixed by its length.
+func encodeBlock(records [][]byte) []byte {
+	var size int
+	for _, p := range records {
+		size += binary.MaxVarintLen64 + len(p)
+	}
+
+	b := make([]byte, 0, size)
+	for _, p := range records {
+		b = binary.AppendUvarint(b, uint64(len(p)))
+		b = append(b, p...)
+	}
+
+	return b
+}
+
+// decodeBlock unpacks the records of a store frame payload. Frames written
+// before blocks hold a single record.
+func decodeBlock(version uint32, b []byte) ([][]byte, error) {
+	if version < storeVersionBlock {
+		return [][]byte{b}, nil
+	}
+
+	var records [][]byte
+	for len(b) > 0 {
+		size, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < size {
+			return nil, errors.New("malformed record block")
+		}
+
+		records = append(records, b[n:n+int(size)])
+		b = b[n+int(size):]
+	}
+
+	return records, nil
+}
+
 func nearestMultiple(j, k uint64) uint64 {
 	if j < 0 {
 		return ((j - k + 1) / k) * k
@@ -2,55 +2,150 @@ package log
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
 	"os"
 	"sync"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
 )
 
 var enc = binary.BigEndian
 
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+const (
+	lenWidth    = 8
+	crcWidth    = 4
+	attrsWidth  = 1
+	headerWidth = 8
+)
+
 const (
-	lenWidth = 8
+	// attrCodecMask selects the compression codec from the attributes byte
+	// of a frame.
+	attrCodecMask byte = 0x07
+	// attrEncrypted flags a payload encrypted after it was compressed.
+	attrEncrypted byte = 0x08
 )
 
+const (
+	// storeVersionLegacy frames are the record length followed by the record.
+	storeVersionLegacy uint32 = iota
+	// storeVersionChecksum frames put a CRC32C of the record between the
+	// length and the record.
+	storeVersionChecksum
+	// storeVersionBlock frames put an attributes byte naming the compression
+	// codec of the payload after the checksum, which covers it too. The
+	// payload is a block of the records appended together.
+	storeVersionBlock
+	// storeVersionEncryption frames may have attrEncrypted set. The bit is
+	// reserved in older versions, which refuse the file rather than take
+	// the frames for corrupt.
+	storeVersionEncryption
+)
+
+// storeVersion is the format new store files are written in.
+const storeVersion = storeVersionEncryption
+
+// storeMagic starts the header of versioned store files. Legacy files start
+// with a record length, whose most significant byte is never set.
+var storeMagic = [4]byte{0xff, 'p', 'l', 'g'}
+
+var errLegacyStore = errors.New("store file is in a legacy format and is read-only")
+
 type store struct {
-	file *os.File
-	size uint64
-	mu   sync.Mutex
-	buf  *bufio.Writer
+	file    *os.File
+	size    uint64
+	version uint32
+	codec   Codec
+	keyring *Keyring
+	mu      sync.Mutex
+	buf     *bufio.Writer
 }
 
-func newStore(f *os.File) (*store, error) {
+func newStore(f *os.File, c Config) (*store, error) {
 	fi, err := os.Stat(f.Name())
 	if err != nil {
 		return nil, fmt.Errorf("get file info of file %s: %w", f.Name(), err)
 	}
 
 	size := uint64(fi.Size())
-	return &store{
-		file: f,
-		size: size,
-		buf:  bufio.NewWriter(f),
-	}, nil
+	s := &store{
+		file:    f,
+		size:    size,
+		codec:   c.Segment.Compression,
+		keyring: c.Encryption.Keyring,
+		buf:     bufio.NewWriter(f),
+	}
+
+	if size == 0 {
+		err = s.writeHeader()
+		if err != nil {
+			return nil, fmt.Errorf("write store header: %w", err)
+		}
+
+		return s, nil
+	}
+
+	s.version, err = s.readHeader()
+	if err != nil {
+		return nil, fmt.Errorf("read store header: %w", err)
+	}
+
+	return s, nil
 }
 
 func (s *store) Append(b []byte) (n uint64, pos uint64, err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.version != storeVersion {
+		return 0, 0, errLegacyStore
+	}
+
+	p, err := s.codec.compress(b)
+	if err != nil {
+		return 0, 0, fmt.Errorf("compress the message with %s: %w", s.codec, err)
+	}
+	attrs := []byte{byte(s.codec)}
+
+	if s.keyring != nil {
+		attrs[0] |= attrEncrypted
+		p, err = s.keyring.seal(p, attrs)
+		if err != nil {
+			return 0, 0, fmt.Errorf("encrypt the message: %w", err)
+		}
+	}
+
 	pos = s.size
-	err = binary.Write(s.buf, binary.BigEndian, uint64(len(b)))
+	err = binary.Write(s.buf, enc, uint64(len(p)))
 	if err != nil {
 		return 0, 0, fmt.Errorf("write the length of the message: %w", err)
 	}
 
-	count, err := s.buf.Write(b)
+	sum := crc32.Update(crc32.Checksum(attrs, crcTable), crcTable, p)
+	err = binary.Write(s.buf, enc, sum)
+	if err != nil {
+		return 0, 0, fmt.Errorf("write the checksum of the message: %w", err)
+	}
+
+	_, err = s.buf.Write(attrs)
+	if err != nil {
+		return 0, 0, fmt.Errorf("write the attributes of the message: %w", err)
+	}
+
+	count, err := s.buf.Write(p)
 	if err != nil {
 		return 0, 0, fmt.Errorf("write the message: %w", err)
 	}
 
-	n = uint64(count + lenWidth)
+	n = uint64(count + lenWidth + crcWidth + attrsWidth)
 	s.size += n
 
 	return n, pos, nil
@@ -65,14 +160,18 @@ func (s *store) Read(pos uint64) ([]byte, error) {
 		return nil, fmt.Errorf("flush logs to file: %w", err)
 	}
 
-	size := make([]byte, lenWidth)
-	_, err = s.file.ReadAt(size, int64(pos))
-	if err != nil {
-		return nil, fmt.Errorf("read the length of the message: %w", err)
+	if pos >= s.size {
+		return nil, fmt.Errorf("read the message at %d: %w", pos, io.EOF)
+	}
+
+	fr := &frameReader{
+		r:       io.NewSectionReader(s.file, int64(pos), int64(s.size-pos)),
+		version: s.version,
+		pos:     pos,
+		keyring: s.keyring,
 	}
 
-	b := make([]byte, enc.Uint64(size))
-	_, err = s.file.ReadAt(b, int64(pos+lenWidth))
+	b, err := fr.Next()
 	if err != nil {
 		return nil, fmt.Errorf("read the message: %w", err)
 	}
@@ -97,6 +196,120 @@ func (s *store) ReadAt(p []byte, offset int64) (int, error) {
 	return n, nil
 }
 
+// scan walks the store from its first record and returns the position of
+// every complete, intact record along with the position where the last one
+// ends. Scanning stops at the first torn or corrupt frame. A frame that
+// can't be decrypted fails the scan instead, since the missing key doesn't
+// make the frame torn.
+func (s *store) scan() (positions []uint64, end uint64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = s.buf.Flush()
+	if err != nil {
+		return nil, 0, fmt.Errorf("flush logs to file: %w", err)
+	}
+
+	start := uint64(0)
+	if s.version != storeVersionLegacy {
+		start = headerWidth
+	}
+
+	if s.size < start {
+		return nil, 0, nil
+	}
+
+	fr := &frameReader{
+		r:       io.NewSectionReader(s.file, int64(start), int64(s.size-start)),
+		version: s.version,
+		pos:     start,
+		keyring: s.keyring,
+	}
+
+	end = start
+	for {
+		pos := fr.pos
+		_, err := fr.Next()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &api.CorruptRecordError{}) {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("read frame at %d: %w", pos, err)
+		}
+
+		positions = append(positions, pos)
+		end = fr.pos
+	}
+
+	return positions, end, nil
+}
+
+// truncate drops everything in the store after size. Truncating a store
+// down to its header or below leaves an empty store in the current format.
+func (s *store) truncate(size uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.buf.Flush()
+	if err != nil {
+		return fmt.Errorf("flush logs to file: %w", err)
+	}
+
+	if size >= s.size {
+		return nil
+	}
+
+	if size <= headerWidth {
+		size = 0
+	}
+
+	err = s.file.Truncate(int64(size))
+	if err != nil {
+		return fmt.Errorf("truncate store file to %d bytes: %w", size, err)
+	}
+	s.size = size
+
+	if size == 0 {
+		err = s.writeHeader()
+		if err != nil {
+			return fmt.Errorf("write store header: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.buf.Flush()
+	if err != nil {
+		return fmt.Errorf("flush logs to file: %w", err)
+	}
+
+	err = s.file.Sync()
+	if err != nil {
+		return fmt.Errorf("sync store file to disk: %w", err)
+	}
+
+	return nil
+}
+
+// open returns a new handle of the store file, once the buffered records
+// are written to it.
+func (s *store) open() (*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.buf.Flush()
+	if err != nil {
+		return nil, fmt.Errorf("flush logs to file: %w", err)
+	}
+
+	return os.Open(s.file.Name())
+}
+
 func (s *store) Name() string {
 	return s.file.Name()
 }
@@ -129,3 +342,170 @@ func (s *store) Remove() error {
 
 	return nil
 }
+
+func (s *store) writeHeader() error {
+	header := make([]byte, headerWidth)
+	copy(header, storeMagic[:])
+	enc.PutUint32(header[len(storeMagic):], storeVersion)
+
+	_, err := s.buf.Write(header)
+	if err != nil {
+		return err
+	}
+
+	s.version = storeVersion
+	s.size += headerWidth
+
+	return nil
+}
+
+func (s *store) readHeader() (uint32, error) {
+	if s.size < headerWidth {
+		return storeVersionLegacy, nil
+	}
+
+	header := make([]byte, headerWidth)
+	_, err := s.file.ReadAt(header, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	version, ok, err := parseHeader(header)
+	if err != nil {
+		return 0, err
+	}
+
+	if !ok {
+		return storeVersionLegacy, nil
+	}
+
+	return version, nil
+}
+
+// parseHeader reports whether b is a store header and which format version
+// it announces.
+func parseHeader(b []byte) (version uint32, ok bool, err error) {
+	if !bytes.Equal(b[:len(storeMagic)], storeMagic[:]) {
+		return 0, false, nil
+	}
+
+	version = enc.Uint32(b[len(storeMagic):headerWidth])
+	if version > storeVersion {
+		return 0, false, fmt.Errorf("unsupported store version %d", version)
+	}
+
+	return version, true, nil
+}
+
+// frameReader decodes the record frames of a store file and returns their
+// decompressed payload. It follows store headers as it meets them, so it can
+// also decode a stream of several store files such as the one produced by
+// Log.Reader.
+type frameReader struct {
+	r       io.Reader
+	version uint32
+	pos     uint64
+	keyring *Keyring
+}
+
+func (fr *frameReader) Next() ([]byte, error) {
+	b := make([]byte, lenWidth)
+	for {
+		_, err := io.ReadFull(fr.r, b)
+		if err != nil {
+			return nil, err
+		}
+
+		version, ok, err := parseHeader(b)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			break
+		}
+
+		fr.version = version
+		fr.pos += headerWidth
+	}
+
+	pos := fr.pos
+	size := enc.Uint64(b)
+	if size > math.MaxInt64 {
+		return nil, api.CorruptRecordError{Pos: pos}
+	}
+
+	var sum uint32
+	n := uint64(lenWidth)
+	if fr.version >= storeVersionChecksum {
+		c := make([]byte, crcWidth)
+		_, err := io.ReadFull(fr.r, c)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		sum = enc.Uint32(c)
+		n += crcWidth
+	}
+
+	attrs := []byte{byte(CodecNone)}
+	if fr.version >= storeVersionBlock {
+		_, err := io.ReadFull(fr.r, attrs)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		n += attrsWidth
+	}
+
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, fr.r, int64(size))
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	fr.pos += n + size
+
+	p := buf.Bytes()
+	switch {
+	case fr.version >= storeVersionBlock:
+		if crc32.Update(crc32.Checksum(attrs, crcTable), crcTable, p) != sum {
+			return nil, api.CorruptRecordError{Pos: pos}
+		}
+	case fr.version >= storeVersionChecksum:
+		if crc32.Checksum(p, crcTable) != sum {
+			return nil, api.CorruptRecordError{Pos: pos}
+		}
+	}
+
+	known := attrCodecMask
+	if fr.version >= storeVersionEncryption {
+		known |= attrEncrypted
+	}
+
+	codec := Codec(attrs[0] & attrCodecMask)
+	if _, ok := codecNames[codec]; !ok || attrs[0]&^known != 0 {
+		return nil, api.CorruptRecordError{Pos: pos}
+	}
+
+	if attrs[0]&attrEncrypted != 0 {
+		p, err = fr.keyring.open(p, attrs)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt the message at %d: %w", pos, err)
+		}
+	}
+
+	p, err = codec.decompress(p)
+	if err != nil {
+		return nil, api.CorruptRecordError{Pos: pos}
+	}
+
+	return p, nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
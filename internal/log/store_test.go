@@ -1,15 +1,18 @@
 package log
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"testing"
 
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
 	"github.com/huytran2000-hcmus/proglog/pkg/testhelper"
 )
 
 var (
 	message = []byte("hello world")
-	width   = uint64(len(message)) + lenWidth
+	width   = uint64(len(message)) + lenWidth + crcWidth + attrsWidth
 )
 
 func TestStore_Append_Read(t *testing.T) {
@@ -19,7 +22,7 @@ func TestStore_Append_Read(t *testing.T) {
 	}
 	defer os.Remove(f.Name())
 
-	s, err := newStore(f)
+	s, err := newStore(f, Config{})
 	if err != nil {
 		t.Errorf("unexpected error after create store: %s", err)
 	}
@@ -37,7 +40,7 @@ func TestStoreClose(t *testing.T) {
 	}
 	defer os.Remove(f.Name())
 
-	s, err := newStore(f)
+	s, err := newStore(f, Config{})
 	if err != nil {
 		t.Errorf("unexpected error after create store: %s", err)
 	}
@@ -66,18 +69,159 @@ func TestStoreClose(t *testing.T) {
 	}
 }
 
+func TestStoreChecksum(t *testing.T) {
+	f, err := os.CreateTemp(os.TempDir(), "store_checksum_test")
+	if err != nil {
+		t.Errorf("unexpected error after create log file: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	s, err := newStore(f, Config{})
+	testhelper.RequireNoError(t, err)
+
+	_, pos, err := s.Append(message)
+	testhelper.RequireNoError(t, err)
+	testhelper.RequireNoError(t, s.Close())
+
+	f, err = os.OpenFile(f.Name(), os.O_RDWR, 0644)
+	testhelper.RequireNoError(t, err)
+
+	_, err = f.WriteAt([]byte("j"), int64(pos+lenWidth+crcWidth+attrsWidth))
+	testhelper.RequireNoError(t, err)
+
+	s, err = newStore(f, Config{})
+	testhelper.RequireNoError(t, err)
+	defer s.Close()
+
+	_, err = s.Read(pos)
+	if !errors.As(err, &api.CorruptRecordError{}) {
+		t.Errorf("want CorruptRecordError, got %v", err)
+	}
+}
+
+func TestStoreLegacyFormat(t *testing.T) {
+	f, err := os.CreateTemp(os.TempDir(), "store_legacy_test")
+	if err != nil {
+		t.Errorf("unexpected error after create log file: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	b := make([]byte, lenWidth)
+	enc.PutUint64(b, uint64(len(message)))
+	_, err = f.Write(append(b, message...))
+	testhelper.RequireNoError(t, err)
+
+	s, err := newStore(f, Config{})
+	testhelper.RequireNoError(t, err)
+	defer s.Close()
+
+	testhelper.AssertEqual(t, storeVersionLegacy, s.version)
+
+	got, err := s.Read(0)
+	testhelper.AssertNoError(t, err)
+	testhelper.AssertEqual(t, message, got)
+
+	_, _, err = s.Append(message)
+	testhelper.AssertError(t, errLegacyStore, err)
+}
+
+func TestStoreCompression(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"event":"job.offered","salary":"six figure"}`), 20)
+
+	for _, codec := range []Codec{CodecNone, CodecGzip, CodecSnappy, CodecZstd} {
+		t.Run(codec.String(), func(t *testing.T) {
+			f, err := os.CreateTemp(os.TempDir(), "store_compression_test")
+			testhelper.RequireNoError(t, err)
+			defer os.Remove(f.Name())
+
+			var c Config
+			c.Segment.Compression = codec
+			s, err := newStore(f, c)
+			testhelper.RequireNoError(t, err)
+			defer s.Close()
+
+			n, pos, err := s.Append(payload)
+			testhelper.RequireNoError(t, err)
+			if codec != CodecNone && n >= uint64(len(payload)) {
+				t.Errorf("want payload compressed below %d bytes, got %d", len(payload), n)
+			}
+
+			attrs := make([]byte, attrsWidth)
+			_, err = s.ReadAt(attrs, int64(pos+lenWidth+crcWidth))
+			testhelper.RequireNoError(t, err)
+			testhelper.AssertEqual(t, byte(codec), attrs[0])
+
+			got, err := s.Read(pos)
+			testhelper.AssertNoError(t, err)
+			testhelper.AssertEqual(t, payload, got)
+		})
+	}
+}
+
+func TestStoreEncryption(t *testing.T) {
+	f, err := os.CreateTemp(os.TempDir(), "store_encryption_test")
+	testhelper.RequireNoError(t, err)
+	defer os.Remove(f.Name())
+
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	var c Config
+	c.Encryption.Keyring, err = NewKeyring(1, map[uint32][]byte{1: oldKey})
+	testhelper.RequireNoError(t, err)
+
+	s, err := newStore(f, c)
+	testhelper.RequireNoError(t, err)
+
+	_, oldPos, err := s.Append(message)
+	testhelper.RequireNoError(t, err)
+	testhelper.RequireNoError(t, s.Close())
+
+	b, err := os.ReadFile(f.Name())
+	testhelper.RequireNoError(t, err)
+	if bytes.Contains(b, message) {
+		t.Errorf("want the message encrypted, found it in plaintext")
+	}
+
+	// rotate to a new key, keeping the old one to read older frames
+	c.Encryption.Keyring, err = NewKeyring(2, map[uint32][]byte{1: oldKey, 2: newKey})
+	testhelper.RequireNoError(t, err)
+
+	f, err = os.OpenFile(f.Name(), os.O_RDWR|os.O_APPEND, 0644)
+	testhelper.RequireNoError(t, err)
+	s, err = newStore(f, c)
+	testhelper.RequireNoError(t, err)
+	defer s.Close()
+
+	_, newPos, err := s.Append(message)
+	testhelper.RequireNoError(t, err)
+
+	for _, pos := range []uint64{oldPos, newPos} {
+		got, err := s.Read(pos)
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, message, got)
+	}
+
+	s.keyring = nil
+	_, err = s.Read(oldPos)
+	testhelper.AssertError(t, errNoKeyring, err)
+
+	_, _, err = s.scan()
+	testhelper.AssertError(t, errNoKeyring, err)
+}
+
 func testStore_Append(t *testing.T, s *store, nLog int) {
 	for i := uint64(1); i <= uint64(nLog); i++ {
 		n, pos, err := s.Append(message)
 		if err != nil {
 			t.Errorf("unexpected error after append log: %s", err)
 		}
-		testhelper.AssertEqual(t, pos+n, width*i)
+		testhelper.AssertEqual(t, pos+n, headerWidth+width*i)
 	}
 }
 
 func testStore_Read(t *testing.T, s *store, nLog int) {
-	var pos uint64
+	var pos uint64 = headerWidth
 	for i := 0; i < nLog; i++ {
 		got, err := s.Read(pos)
 		if err != nil {
@@ -89,7 +233,7 @@ func testStore_Read(t *testing.T, s *store, nLog int) {
 }
 
 func testStore_ReadAt(t *testing.T, s *store, nLog int) {
-	var offset int64
+	var offset int64 = headerWidth
 	for i := 0; i < nLog; i++ {
 		b := make([]byte, lenWidth)
 		n, err := s.ReadAt(b, offset)
@@ -102,6 +246,22 @@ func testStore_ReadAt(t *testing.T, s *store, nLog int) {
 		size := enc.Uint64(b)
 		testhelper.AssertEqual(t, len(message), int(size))
 
+		b = make([]byte, crcWidth)
+		n, err = s.ReadAt(b, offset)
+		if err != nil {
+			t.Errorf("unexpected error after read at offset %d: %s", offset, err)
+		}
+		testhelper.AssertEqual(t, crcWidth, n)
+		offset += int64(n)
+
+		b = make([]byte, attrsWidth)
+		n, err = s.ReadAt(b, offset)
+		if err != nil {
+			t.Errorf("unexpected error after read at offset %d: %s", offset, err)
+		}
+		testhelper.AssertEqual(t, byte(CodecNone), b[0])
+		offset += int64(n)
+
 		b = make([]byte, size)
 		n, err = s.ReadAt(b, offset)
 		if err != nil {
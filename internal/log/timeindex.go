@@ -0,0 +1,132 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+var (
+	tsWidth        uint64 = 8
+	timeEntryWidth uint64 = tsWidth + offWidth
+)
+
+// timeIndex is a sparse index from record timestamps to offsets. Each entry
+// holds the largest timestamp in the segment so far and the offset of the
+// record carrying it, so every record before that offset is older.
+type timeIndex struct {
+	file    *os.File
+	entries []timeEntry
+}
+
+type timeEntry struct {
+	timestamp int64
+	off       uint32
+}
+
+func newTimeIndex(f *os.File) (*timeIndex, error) {
+	b, err := io.ReadAll(io.NewSectionReader(f, 0, 1<<62))
+	if err != nil {
+		return nil, fmt.Errorf("read time index file: %w", err)
+	}
+
+	t := &timeIndex{file: f}
+	for at := uint64(0); at+timeEntryWidth <= uint64(len(b)); at += timeEntryWidth {
+		t.entries = append(t.entries, timeEntry{
+			timestamp: int64(enc.Uint64(b[at : at+tsWidth])),
+			off:       enc.Uint32(b[at+tsWidth : at+timeEntryWidth]),
+		})
+	}
+
+	// drop an entry torn by a crash
+	size := int64(uint64(len(t.entries)) * timeEntryWidth)
+	if size != int64(len(b)) {
+		err = f.Truncate(size)
+		if err != nil {
+			return nil, fmt.Errorf("truncate time index file: %w", err)
+		}
+	}
+
+	return t, nil
+}
+
+func (t *timeIndex) Write(timestamp int64, off uint32) error {
+	b := make([]byte, timeEntryWidth)
+	enc.PutUint64(b[:tsWidth], uint64(timestamp))
+	enc.PutUint32(b[tsWidth:], off)
+
+	_, err := t.file.Write(b)
+	if err != nil {
+		return err
+	}
+
+	t.entries = append(t.entries, timeEntry{timestamp: timestamp, off: off})
+
+	return nil
+}
+
+// Lookup returns the last entry older than timestamp. Every record up to and
+// including the entry's offset is older than timestamp.
+func (t *timeIndex) Lookup(timestamp int64) (timeEntry, bool) {
+	i := sort.Search(len(t.entries), func(i int) bool {
+		return t.entries[i].timestamp >= timestamp
+	})
+	if i == 0 {
+		return timeEntry{}, false
+	}
+
+	return t.entries[i-1], true
+}
+
+func (t *timeIndex) Last() (timeEntry, bool) {
+	if len(t.entries) == 0 {
+		return timeEntry{}, false
+	}
+
+	return t.entries[len(t.entries)-1], true
+}
+
+// truncate drops the entries pointing at or past the relative offset off.
+func (t *timeIndex) truncate(off uint32) error {
+	i := sort.Search(len(t.entries), func(i int) bool {
+		return t.entries[i].off >= off
+	})
+	if i == len(t.entries) {
+		return nil
+	}
+
+	err := t.file.Truncate(int64(uint64(i) * timeEntryWidth))
+	if err != nil {
+		return err
+	}
+	t.entries = t.entries[:i]
+
+	return nil
+}
+
+func (t *timeIndex) Name() string {
+	return t.file.Name()
+}
+
+func (t *timeIndex) Sync() error {
+	return t.file.Sync()
+}
+
+func (t *timeIndex) Close() error {
+	err := t.file.Close()
+	if err != nil {
+		return fmt.Errorf("close time index file: %w", err)
+	}
+
+	return nil
+}
+
+func (t *timeIndex) Remove() error {
+	err := os.Remove(t.file.Name())
+	if err != nil {
+		return fmt.Errorf("remove time index file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,390 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+)
+
+// DefaultTopic is the topic of the requests that don't name one. Its first
+// partition is kept where the single log of a node used to be.
+const DefaultTopic = api.DefaultTopic
+
+var topicNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// Topics holds the logs of every topic of a node. A topic is split into
+// partitions, each with its own log, and records are only ordered within a
+// partition.
+type Topics struct {
+	Config Config
+	dir    string
+	mu     sync.RWMutex
+	logs   map[string][]*Log
+
+	offsetsMu sync.RWMutex
+	offsets   map[offsetKey]uint64
+}
+
+func NewTopics(dataDir string, c Config) (*Topics, error) {
+	if c.Topic.Partitions == 0 {
+		c.Topic.Partitions = 1
+	}
+
+	t := &Topics{
+		Config: c,
+		dir:    dataDir,
+		logs:   make(map[string][]*Log),
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dataDir, "topics"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read topics dir: %w", err)
+	}
+
+	names := []string{DefaultTopic, OffsetsTopic}
+	for _, ent := range entries {
+		if ent.IsDir() && ent.Name() != DefaultTopic && ent.Name() != OffsetsTopic {
+			names = append(names, ent.Name())
+		}
+	}
+
+	for _, name := range names {
+		partitions, err := t.partitionsOnDisk(name)
+		if err != nil {
+			return nil, err
+		}
+
+		err = t.open(name, partitions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = t.loadOffsets()
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *Topics) Append(topic string, partition uint32, record *api.Record) (uint64, error) {
+	if IsInternalTopic(topic) {
+		return 0, api.InvalidTopicError{Topic: topic, Reason: "internal topics can't be produced to"}
+	}
+
+	l, err := t.Log(topic, partition)
+	if err != nil {
+		return 0, err
+	}
+
+	return l.Append(record)
+}
+
+func (t *Topics) AppendBatch(topic string, partition uint32, records []*api.Record) (uint64, error) {
+	if IsInternalTopic(topic) {
+		return 0, api.InvalidTopicError{Topic: topic, Reason: "internal topics can't be produced to"}
+	}
+
+	l, err := t.Log(topic, partition)
+	if err != nil {
+		return 0, err
+	}
+
+	return l.AppendBatch(records)
+}
+
+func (t *Topics) Read(topic string, partition uint32, offset uint64) (*api.Record, error) {
+	l, err := t.Log(topic, partition)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.Read(offset)
+}
+
+func (t *Topics) Wait(ctx context.Context, topic string, partition uint32, offset uint64) error {
+	l, err := t.Log(topic, partition)
+	if err != nil {
+		return err
+	}
+
+	return l.Wait(ctx, offset)
+}
+
+func (t *Topics) OffsetForTime(topic string, partition uint32, at time.Time) (uint64, error) {
+	l, err := t.Log(topic, partition)
+	if err != nil {
+		return 0, err
+	}
+
+	return l.OffsetForTime(at)
+}
+
+// Log returns the log of the partition of the topic. An empty topic names
+// the default one.
+func (t *Topics) Log(topic string, partition uint32) (*Log, error) {
+	topic = topicOrDefault(topic)
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	logs, ok := t.logs[topic]
+	if !ok {
+		return nil, api.TopicNotFoundError{Topic: topic}
+	}
+
+	if partition >= uint32(len(logs)) {
+		return nil, api.PartitionNotFoundError{Topic: topic, Partition: partition}
+	}
+
+	return logs[partition], nil
+}
+
+// Partitions returns the number of partitions of the topic.
+func (t *Topics) Partitions(topic string) (uint32, error) {
+	topic = topicOrDefault(topic)
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	logs, ok := t.logs[topic]
+	if !ok {
+		return 0, api.TopicNotFoundError{Topic: topic}
+	}
+
+	return uint32(len(logs)), nil
+}
+
+// CreateTopic creates the topic with the number of partitions, or with the
+// configured number if it is zero.
+func (t *Topics) CreateTopic(name string, partitions uint32) error {
+	err := validateTopic(name)
+	if err != nil {
+		return err
+	}
+
+	if partitions == 0 {
+		partitions = t.Config.Topic.Partitions
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.logs[name]; ok {
+		return api.TopicExistsError{Topic: name}
+	}
+
+	return t.openLocked(name, partitions)
+}
+
+// DeleteTopic removes the topic, its records and the offsets committed for
+// it. The default and the internal topics can't be deleted. The tombstones of
+// the offsets get the timestamp, in Unix nanoseconds.
+func (t *Topics) DeleteTopic(name string, timestamp int64) error {
+	if name == DefaultTopic || name == "" {
+		return api.InvalidTopicError{Topic: DefaultTopic, Reason: "the default topic can't be deleted"}
+	}
+
+	if IsInternalTopic(name) {
+		return api.InvalidTopicError{Topic: name, Reason: "internal topics can't be deleted"}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.removeLocked(name)
+	if err != nil {
+		return err
+	}
+
+	return t.dropOffsets(t.logs[OffsetsTopic][0], name, timestamp)
+}
+
+func (t *Topics) removeLocked(name string) error {
+	logs, ok := t.logs[name]
+	if !ok {
+		return api.TopicNotFoundError{Topic: name}
+	}
+
+	delete(t.logs, name)
+
+	for p, l := range logs {
+		err := l.Remove()
+		if err != nil {
+			return fmt.Errorf("remove partition %d: %w", p, err)
+		}
+	}
+
+	return os.RemoveAll(t.topicDir(name))
+}
+
+// ListTopics returns the names of the topics in order.
+func (t *Topics) ListTopics() ([]string, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	names := make([]string, 0, len(t.logs))
+	for name := range t.logs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (t *Topics) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name, logs := range t.logs {
+		for p, l := range logs {
+			err := l.Close()
+			if err != nil {
+				return fmt.Errorf("close partition %d of topic %s: %w", p, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ensure returns the log of the partition of the topic, creating the topic
+// or the partitions up to it if they are missing.
+func (t *Topics) ensure(name string, partition uint32) (*Log, error) {
+	name = topicOrDefault(name)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.openLocked(name, partition+1)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.logs[name][partition], nil
+}
+
+// retain removes the topics missing from names. The offsets committed for
+// them are left to the offsets topic the names come with.
+func (t *Topics) retain(names map[string]bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name := range t.logs {
+		if names[name] || name == DefaultTopic || IsInternalTopic(name) {
+			continue
+		}
+
+		err := t.removeLocked(name)
+		if err != nil {
+			return fmt.Errorf("remove topic %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (t *Topics) open(name string, partitions uint32) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.openLocked(name, partitions)
+}
+
+// openLocked opens the partitions of the topic it doesn't have open yet, up
+// to the number of partitions.
+func (t *Topics) openLocked(name string, partitions uint32) error {
+	c := t.Config
+	if name == OffsetsTopic {
+		c = offsetsConfig(c)
+	}
+
+	logs := t.logs[name]
+	for p := uint32(len(logs)); p < partitions; p++ {
+		dir := t.partitionDir(name, p)
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return fmt.Errorf("create dir of partition %d of topic %s: %w", p, name, err)
+		}
+
+		l, err := New(dir, c)
+		if err != nil {
+			return fmt.Errorf("open log of partition %d of topic %s: %w", p, name, err)
+		}
+		logs = append(logs, l)
+	}
+	t.logs[name] = logs
+
+	return nil
+}
+
+// partitionsOnDisk returns the number of partitions the topic has in its
+// dir. A topic has at least one partition.
+func (t *Topics) partitionsOnDisk(name string) (uint32, error) {
+	partitions := uint32(1)
+
+	entries, err := os.ReadDir(t.topicDir(name))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("read dir of topic %s: %w", name, err)
+	}
+
+	for _, ent := range entries {
+		p, err := strconv.ParseUint(ent.Name(), 10, 32)
+		if err != nil || !ent.IsDir() {
+			continue
+		}
+
+		if uint32(p) >= partitions {
+			partitions = uint32(p) + 1
+		}
+	}
+
+	return partitions, nil
+}
+
+func (t *Topics) topicDir(name string) string {
+	return filepath.Join(t.dir, "topics", name)
+}
+
+func (t *Topics) partitionDir(name string, partition uint32) string {
+	if name == DefaultTopic && partition == 0 {
+		return filepath.Join(t.dir, "log")
+	}
+
+	return filepath.Join(t.topicDir(name), strconv.FormatUint(uint64(partition), 10))
+}
+
+func topicOrDefault(topic string) string {
+	if topic == "" {
+		return DefaultTopic
+	}
+
+	return topic
+}
+
+func validateTopic(name string) error {
+	if !topicNameRegexp.MatchString(name) || name == "." || name == ".." {
+		return api.InvalidTopicError{
+			Topic:  name,
+			Reason: "topic names are 1 to 249 letters, digits, '.', '_' or '-'",
+		}
+	}
+
+	if IsInternalTopic(name) {
+		return api.InvalidTopicError{
+			Topic:  name,
+			Reason: fmt.Sprintf("topic names starting with %q are internal", api.InternalTopicPrefix),
+		}
+	}
+
+	return nil
+}
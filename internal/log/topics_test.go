@@ -0,0 +1,259 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+	"github.com/huytran2000-hcmus/proglog/pkg/testhelper"
+)
+
+func TestTopics(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "topics-test")
+	testhelper.RequireNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var c Config
+	c.Segment.MaxStoreBytes = 256
+
+	topics, err := NewTopics(dir, c)
+	testhelper.RequireNoError(t, err)
+
+	err = topics.CreateTopic("orders", 3)
+	testhelper.RequireNoError(t, err)
+
+	err = topics.CreateTopic("orders", 3)
+	testhelper.AssertError(t, api.TopicExistsError{Topic: "orders"}, err)
+
+	for _, name := range []string{"", "..", "orders/eu", "orders eu"} {
+		err = topics.CreateTopic(name, 0)
+		testhelper.AssertEqual(t, true, err != nil)
+	}
+
+	err = topics.DeleteTopic(DefaultTopic, 0)
+	testhelper.AssertEqual(t, true, err != nil)
+
+	_, err = topics.Append("payments", 0, &api.Record{Value: []byte("payment")})
+	testhelper.AssertError(t, api.TopicNotFoundError{Topic: "payments"}, err)
+
+	_, err = topics.Append("orders", 3, &api.Record{Value: []byte("order")})
+	testhelper.AssertError(t, api.PartitionNotFoundError{Topic: "orders", Partition: 3}, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = topics.Append("", 0, &api.Record{Value: []byte("default")})
+		testhelper.RequireNoError(t, err)
+	}
+
+	// every partition has its own offsets
+	for p := uint32(0); p < 3; p++ {
+		offset, err := topics.Append("orders", p, &api.Record{Value: []byte(fmt.Sprintf("order %d", p))})
+		testhelper.RequireNoError(t, err)
+		testhelper.AssertEqual(t, uint64(0), offset)
+	}
+
+	_, err = topics.Append(OffsetsTopic, 0, &api.Record{Value: []byte("offset")})
+	testhelper.AssertEqual(t, true, err != nil)
+
+	err = topics.CommitOffset("billing", "orders", 1, 1, 0)
+	testhelper.RequireNoError(t, err)
+
+	err = topics.CommitOffset("billing", "orders", 1, 2, 0)
+	testhelper.RequireNoError(t, err)
+
+	err = topics.CommitOffset("billing", "", 0, 3, 0)
+	testhelper.RequireNoError(t, err)
+
+	assertTopics := func(t *testing.T, topics *Topics) {
+		t.Helper()
+
+		names, err := topics.ListTopics()
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, []string{OffsetsTopic, DefaultTopic, "orders"}, names)
+
+		partitions, err := topics.Partitions("orders")
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, uint32(3), partitions)
+
+		got, err := topics.Read(DefaultTopic, 0, 2)
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, []byte("default"), got.Value)
+
+		for p := uint32(0); p < partitions; p++ {
+			got, err = topics.Read("orders", p, 0)
+			testhelper.AssertNoError(t, err)
+			testhelper.AssertEqual(t, []byte(fmt.Sprintf("order %d", p)), got.Value)
+		}
+
+		offset, err := topics.CommittedOffset("billing", "orders", 1)
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, uint64(2), offset)
+
+		offset, err = topics.CommittedOffset("billing", DefaultTopic, 0)
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, uint64(3), offset)
+
+		_, err = topics.CommittedOffset("shipping", "orders", 1)
+		testhelper.AssertError(t, api.OffsetNotCommittedError{Group: "shipping", Topic: "orders", Partition: 1}, err)
+	}
+
+	err = topics.Close()
+	testhelper.RequireNoError(t, err)
+
+	topics, err = NewTopics(dir, c)
+	testhelper.RequireNoError(t, err)
+	defer topics.Close()
+
+	assertTopics(t, topics)
+
+	t.Run("restore snapshot", func(t *testing.T) {
+		groups := newGroups()
+		joined, err := groups.join(&api.JoinGroupRequest{Group: "billing", Topic: "orders", MemberId: "member"}, 3)
+		testhelper.RequireNoError(t, err)
+
+		producers := newProducers()
+		producer, err := producers.init(0)
+		testhelper.RequireNoError(t, err)
+		producers.record(producer.ProducerId, "orders", 1, 7, 42)
+
+		txns := newTxns()
+		open, aborted := txns.begin(1, 0), txns.begin(1, 0)
+		txns.record(open, "orders", 2, 5)
+		err = txns.end(aborted, 1, 0, false, func(string, uint32) uint64 { return 0 })
+		testhelper.RequireNoError(t, err)
+
+		snap, err := (&fsm{topics: topics, groups: groups, producers: producers, txns: txns}).Snapshot()
+		testhelper.RequireNoError(t, err)
+
+		sink := &snapshotSink{}
+		err = snap.Persist(sink)
+		testhelper.RequireNoError(t, err)
+
+		restoreDir, err := os.MkdirTemp(os.TempDir(), "topics-test")
+		testhelper.RequireNoError(t, err)
+		defer os.RemoveAll(restoreDir)
+
+		restored, err := NewTopics(restoreDir, c)
+		testhelper.RequireNoError(t, err)
+		defer restored.Close()
+
+		// topics missing from the snapshot are removed
+		err = restored.CreateTopic("payments", 0)
+		testhelper.RequireNoError(t, err)
+
+		restoredGroups := newGroups()
+		restoredProducers := newProducers()
+		restoredTxns := newTxns()
+		err = (&fsm{topics: restored, groups: restoredGroups, producers: restoredProducers, txns: restoredTxns}).Restore(io.NopCloser(bytes.NewReader(sink.Bytes())))
+		testhelper.RequireNoError(t, err)
+
+		assertTopics(t, restored)
+
+		err = restoredGroups.checkPartition("billing", "member", joined.Generation, "orders", 2)
+		testhelper.AssertNoError(t, err)
+
+		offset, dup, err := restoredProducers.lookup(producer.ProducerId, producer.ProducerEpoch, "orders", 1, 7)
+		testhelper.RequireNoError(t, err)
+		testhelper.AssertEqual(t, true, dup)
+		testhelper.AssertEqual(t, uint64(42), offset)
+
+		stable, ok := restoredTxns.stableOffset("orders", 2)
+		testhelper.AssertEqual(t, true, ok)
+		testhelper.AssertEqual(t, uint64(5), stable)
+		testhelper.AssertEqual(t, false, restoredTxns.visible(&api.Record{TxnId: aborted}))
+	})
+
+	t.Run("delete topic", func(t *testing.T) {
+		err := topics.DeleteTopic("orders", 0)
+		testhelper.RequireNoError(t, err)
+
+		_, err = topics.Read("orders", 0, 0)
+		testhelper.AssertError(t, api.TopicNotFoundError{Topic: "orders"}, err)
+
+		_, err = os.Stat(topics.topicDir("orders"))
+		testhelper.AssertError(t, os.ErrNotExist, err)
+
+		// the offsets committed for the topic are gone for good
+		err = topics.loadOffsets()
+		testhelper.RequireNoError(t, err)
+
+		_, err = topics.CommittedOffset("billing", "orders", 1)
+		testhelper.AssertError(t, api.OffsetNotCommittedError{Group: "billing", Topic: "orders", Partition: 1}, err)
+	})
+}
+
+func TestTopicsOffsetsOutliveRetention(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "topics-retention-test")
+	testhelper.RequireNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var c Config
+	c.Segment.MaxStoreBytes = 128
+	c.Retention.MaxBytes = 1
+
+	topics, err := NewTopics(dir, c)
+	testhelper.RequireNoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		err = topics.CommitOffset(fmt.Sprintf("group-%d", i), "", 0, uint64(i), 0)
+		testhelper.RequireNoError(t, err)
+	}
+
+	l, err := topics.Log(OffsetsTopic, 0)
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, true, l.Segments() > 1)
+
+	err = l.EnforceRetention()
+	testhelper.RequireNoError(t, err)
+
+	err = topics.Close()
+	testhelper.RequireNoError(t, err)
+
+	topics, err = NewTopics(dir, c)
+	testhelper.RequireNoError(t, err)
+	defer topics.Close()
+
+	for i := 0; i < 10; i++ {
+		offset, err := topics.CommittedOffset(fmt.Sprintf("group-%d", i), "", 0)
+		testhelper.RequireNoError(t, err)
+		testhelper.AssertEqual(t, uint64(i), offset)
+	}
+}
+
+func TestTopicsDropOffsetsInOrder(t *testing.T) {
+	dir, err := os.MkdirTemp(os.TempDir(), "topics-drop-offsets-test")
+	testhelper.RequireNoError(t, err)
+	defer os.RemoveAll(dir)
+
+	topics, err := NewTopics(dir, Config{})
+	testhelper.RequireNoError(t, err)
+	defer topics.Close()
+
+	err = topics.CreateTopic("orders", 2)
+	testhelper.RequireNoError(t, err)
+
+	var want [][]byte
+	for _, group := range []string{"a", "b", "c"} {
+		for p := uint32(0); p < 2; p++ {
+			want = append(want, offsetKey{group: group, topic: "orders", partition: p}.bytes())
+		}
+	}
+	for _, i := range []int{3, 0, 5, 1, 4, 2} {
+		key, _ := parseOffsetKey(want[i])
+		err = topics.CommitOffset(key.group, key.topic, key.partition, 1, 0)
+		testhelper.RequireNoError(t, err)
+	}
+
+	err = topics.DeleteTopic("orders", 0)
+	testhelper.RequireNoError(t, err)
+
+	var got [][]byte
+	for offset := uint64(len(want)); offset < uint64(2*len(want)); offset++ {
+		record, err := topics.Read(OffsetsTopic, 0, offset)
+		testhelper.RequireNoError(t, err)
+		got = append(got, record.Key)
+	}
+	testhelper.AssertEqual(t, want, got)
+}
@@ -0,0 +1,309 @@
+package log
+
+import (
+	"encoding/json"
+	"sync"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+)
+
+// txns holds the open transactions and the aborted ones. It is state of the
+// FSM, so every replica hides the same records from read_committed
+// consumers. A committed transaction is simply forgotten, its records are
+// visible like any other.
+type txns struct {
+	mu    sync.RWMutex
+	state txnsState
+	// ended is closed and replaced every time a transaction ends, to wake up
+	// the read_committed readers waiting for it.
+	ended chan struct{}
+}
+
+// txnsState is kept in the snapshots as JSON.
+type txnsState struct {
+	NextID uint64          `json:"next_id"`
+	Open   map[uint64]*txn `json:"open"`
+	// Aborted holds the next offset of every partition an aborted
+	// transaction appended to when it was aborted, by topic and partition.
+	// Its records are all below it.
+	Aborted map[uint64]map[string]uint64 `json:"aborted"`
+}
+
+type txn struct {
+	// ProducerID and ProducerEpoch are the producer that began the
+	// transaction, the only one that may produce in it and end it.
+	ProducerID    uint64 `json:"producer_id"`
+	ProducerEpoch uint32 `json:"producer_epoch"`
+	// First holds the offset of the first record of the transaction in
+	// every partition it appended to, by topic and partition.
+	First map[string]uint64 `json:"first"`
+}
+
+// txnStatus is the state of the transaction of a record.
+type txnStatus int
+
+const (
+	// txnCommitted is also the state of the records outside of a
+	// transaction.
+	txnCommitted txnStatus = iota
+	txnOpen
+	txnAborted
+)
+
+func newTxns() *txns {
+	return &txns{
+		state: newTxnsState(),
+		ended: make(chan struct{}),
+	}
+}
+
+func newTxnsState() txnsState {
+	return txnsState{
+		NextID:  1,
+		Open:    make(map[uint64]*txn),
+		Aborted: make(map[uint64]map[string]uint64),
+	}
+}
+
+// begin opens a transaction of the epoch of the producer.
+func (t *txns) begin(producerID uint64, epoch uint32) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := t.state.NextID
+	t.state.NextID++
+	t.state.Open[id] = &txn{
+		ProducerID:    producerID,
+		ProducerEpoch: epoch,
+		First:         make(map[string]uint64),
+	}
+
+	return id
+}
+
+// check returns an error unless the transaction is open and was begun by
+// the epoch of the producer.
+func (t *txns) check(id, producerID uint64, epoch uint32) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	_, err := t.ownedLocked(id, producerID, epoch)
+	return err
+}
+
+func (t *txns) ownedLocked(id, producerID uint64, epoch uint32) (*txn, error) {
+	tx := t.state.Open[id]
+	if tx == nil {
+		return nil, api.TxnNotOpenError{TxnID: id}
+	}
+
+	if tx.ProducerID != producerID || tx.ProducerEpoch != epoch {
+		return nil, api.TxnProducerError{TxnID: id, ProducerID: producerID, Epoch: epoch}
+	}
+
+	return tx, nil
+}
+
+// owner returns the producer and the epoch that began the open
+// transaction, and false if it isn't open.
+func (t *txns) owner(id uint64) (uint64, uint32, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	tx := t.state.Open[id]
+	if tx == nil {
+		return 0, 0, false
+	}
+
+	return tx.ProducerID, tx.ProducerEpoch, true
+}
+
+// record remembers the offset the transaction first appended to the
+// partition at.
+func (t *txns) record(id uint64, topic string, partition uint32, offset uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, ok := t.state.Open[id]
+	if !ok {
+		return
+	}
+
+	key := partitionKey(topic, partition)
+	if _, ok := tx.First[key]; !ok {
+		tx.First[key] = offset
+	}
+}
+
+// end commits or aborts the open transaction of the epoch of the producer.
+// next returns the next offset of a partition an aborted transaction
+// appended to.
+func (t *txns) end(id, producerID uint64, epoch uint32, commit bool, next func(topic string, partition uint32) uint64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, err := t.ownedLocked(id, producerID, epoch)
+	if err != nil {
+		return err
+	}
+
+	delete(t.state.Open, id)
+	if !commit {
+		ends := make(map[string]uint64, len(tx.First))
+		for key := range tx.First {
+			topic, partition, ok := parsePartitionKey(key)
+			if ok {
+				ends[key] = next(topic, partition)
+			}
+		}
+		t.state.Aborted[id] = ends
+	}
+
+	t.notifyLocked()
+
+	return nil
+}
+
+// visible reports whether the record can be read by read_committed
+// consumers. The records of open transactions aren't visible yet, and the
+// ones of aborted transactions never are.
+func (t *txns) visible(record *api.Record) bool {
+	if record.TxnId == 0 {
+		return true
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	_, aborted := t.state.Aborted[record.TxnId]
+	return t.state.Open[record.TxnId] == nil && !aborted
+}
+
+// status returns the state of the transaction.
+func (t *txns) status(id uint64) txnStatus {
+	if id == 0 {
+		return txnCommitted
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.state.Open[id] != nil {
+		return txnOpen
+	}
+
+	if _, aborted := t.state.Aborted[id]; aborted {
+		return txnAborted
+	}
+
+	return txnCommitted
+}
+
+// openIDs returns the IDs of the open transactions.
+func (t *txns) openIDs() []uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	ids := make([]uint64, 0, len(t.state.Open))
+	for id := range t.state.Open {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// prune forgets the aborted transactions whose records are all gone, every
+// partition they appended to having dropped the offsets below their end.
+// lowest returns the lowest offset of a partition, and false once it's
+// deleted. The records left decide, so replicas may prune at different
+// times without reading different records.
+func (t *txns) prune(lowest func(topic string, partition uint32) (uint64, bool)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, ends := range t.state.Aborted {
+		gone := true
+		for key, end := range ends {
+			topic, partition, ok := parsePartitionKey(key)
+			if !ok {
+				continue
+			}
+
+			offset, ok := lowest(topic, partition)
+			if ok && offset < end {
+				gone = false
+				break
+			}
+		}
+
+		if gone {
+			delete(t.state.Aborted, id)
+		}
+	}
+}
+
+// open reports whether the transaction is open.
+func (t *txns) open(id uint64) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.state.Open[id] != nil
+}
+
+// stableOffset returns the first offset of the partition a transaction
+// still open appended to, and false if there is none. read_committed
+// consumers don't read from it on, so they see the records in order.
+func (t *txns) stableOffset(topic string, partition uint32) (uint64, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	key := partitionKey(topic, partition)
+	var stable uint64
+	found := false
+	for _, tx := range t.state.Open {
+		first, ok := tx.First[key]
+		if ok && (!found || first < stable) {
+			stable = first
+			found = true
+		}
+	}
+
+	return stable, found
+}
+
+// waitEnded returns a channel closed once the next transaction ends.
+func (t *txns) waitEnded() <-chan struct{} {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.ended
+}
+
+func (t *txns) marshal() ([]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return json.Marshal(t.state)
+}
+
+func (t *txns) unmarshal(b []byte) error {
+	state := newTxnsState()
+	if len(b) > 0 {
+		err := json.Unmarshal(b, &state)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.mu.Lock()
+	t.state = state
+	t.notifyLocked()
+	t.mu.Unlock()
+
+	return nil
+}
+
+func (t *txns) notifyLocked() {
+	close(t.ended)
+	t.ended = make(chan struct{})
+}
@@ -0,0 +1,47 @@
+package log
+
+import (
+	"testing"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+	"github.com/huytran2000-hcmus/proglog/pkg/testhelper"
+)
+
+func TestTxnsPrune(t *testing.T) {
+	txns := newTxns()
+	next := map[string]uint64{"orders/0": 10, "orders/1": 4, "payments/0": 7}
+
+	aborted, other := txns.begin(1, 0), txns.begin(1, 0)
+	txns.record(aborted, "orders", 0, 8)
+	txns.record(aborted, "orders", 1, 2)
+	txns.record(other, "payments", 0, 6)
+	for _, id := range []uint64{aborted, other} {
+		err := txns.end(id, 1, 0, false, func(topic string, partition uint32) uint64 {
+			return next[partitionKey(topic, partition)]
+		})
+		testhelper.RequireNoError(t, err)
+	}
+
+	lowest := map[string]uint64{"orders/0": 10, "orders/1": 3, "payments/0": 0}
+	prune := func() {
+		txns.prune(func(topic string, partition uint32) (uint64, bool) {
+			offset, ok := lowest[partitionKey(topic, partition)]
+			return offset, ok
+		})
+	}
+
+	// a record of the transaction is left in orders/1
+	prune()
+	testhelper.AssertEqual(t, false, txns.visible(&api.Record{TxnId: aborted}))
+	testhelper.AssertEqual(t, false, txns.visible(&api.Record{TxnId: other}))
+
+	lowest["orders/1"] = 4
+	prune()
+	testhelper.AssertEqual(t, true, txns.visible(&api.Record{TxnId: aborted}))
+	testhelper.AssertEqual(t, false, txns.visible(&api.Record{TxnId: other}))
+
+	// the records of a deleted topic are gone with it
+	delete(lowest, "payments/0")
+	prune()
+	testhelper.AssertEqual(t, 0, len(txns.state.Aborted))
+}
@@ -0,0 +1,612 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+)
+
+// filter is a parsed filter expression of a ConsumeRequest. It is a boolean
+// expression over the fields of a record:
+//
+//	type, key, offset, timestamp  the fields of the record
+//	headers.name, headers["name"] the value of the header named name
+//	value                         the value of the record as a string
+//	value.a.b, value["a"][0]      the field of the value parsed as JSON
+//
+// combined with the literals "text", 12.5, true, false and null, the
+// operators == != < <= > >= && || ! and parentheses, and the functions
+// startsWith(s, prefix), endsWith(s, suffix), contains(s, sub) and
+// has(field). A field that is missing is null, and comparing values of
+// different types is false.
+type filter struct {
+	root node
+}
+
+const (
+	// maxFilterBytes and maxFilterDepth bound the work and the stack a
+	// filter takes to parse and evaluate.
+	maxFilterBytes = 4 << 10
+	maxFilterDepth = 64
+)
+
+func parseFilter(expr string) (*filter, error) {
+	if len(expr) > maxFilterBytes {
+		return nil, fmt.Errorf("filter longer than %d bytes", maxFilterBytes)
+	}
+
+	p := &parser{lexer: lexer{input: expr}}
+	p.next()
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokenEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+
+	return &filter{root: root}, nil
+}
+
+// match reports whether the record passes the filter.
+func (f *filter) match(record *api.Record) bool {
+	v, _ := f.root.eval(&filterEnv{record: record}).(bool)
+	return v
+}
+
+// filterEnv holds the record a filter is evaluated against, with its value
+// parsed as JSON once it's needed.
+type filterEnv struct {
+	record *api.Record
+	parsed bool
+	value  interface{}
+}
+
+func (e *filterEnv) json() interface{} {
+	if !e.parsed {
+		e.parsed = true
+		dec := json.NewDecoder(bytes.NewReader(e.record.Value))
+		dec.UseNumber()
+		if dec.Decode(&e.value) != nil {
+			e.value = nil
+		}
+	}
+
+	return e.value
+}
+
+type node interface {
+	eval(env *filterEnv) interface{}
+}
+
+type literal struct {
+	value interface{}
+}
+
+func (n literal) eval(*filterEnv) interface{} {
+	return n.value
+}
+
+// field is a field of the record, followed by the path into it.
+type field struct {
+	name string
+	path []string
+}
+
+func (n field) eval(env *filterEnv) interface{} {
+	r := env.record
+	switch n.name {
+	case "type":
+		return n.walk(float64(r.Type))
+	case "offset":
+		return n.walk(float64(r.Offset))
+	case "timestamp":
+		return n.walk(float64(r.Timestamp))
+	case "key":
+		if len(n.path) > 0 || r.Key == nil {
+			return nil
+		}
+		return string(r.Key)
+	case "headers":
+		if len(n.path) != 1 {
+			return nil
+		}
+		for _, h := range r.Headers {
+			if h.Key == n.path[0] {
+				return string(h.Value)
+			}
+		}
+		return nil
+	case "value":
+		if len(n.path) == 0 {
+			return string(r.Value)
+		}
+		return n.walk(env.json())
+	}
+
+	return nil
+}
+
+// walk follows the path into the JSON value v.
+func (n field) walk(v interface{}) interface{} {
+	for _, step := range n.path {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v = t[step]
+		case []interface{}:
+			i, err := strconv.Atoi(step)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil
+			}
+			v = t[i]
+		default:
+			return nil
+		}
+	}
+
+	if num, ok := v.(json.Number); ok {
+		f, err := num.Float64()
+		if err != nil {
+			return nil
+		}
+		return f
+	}
+
+	return v
+}
+
+type not struct {
+	operand node
+}
+
+func (n not) eval(env *filterEnv) interface{} {
+	v, _ := n.operand.eval(env).(bool)
+	return !v
+}
+
+type logical struct {
+	op          string
+	left, right node
+}
+
+func (n logical) eval(env *filterEnv) interface{} {
+	left, _ := n.left.eval(env).(bool)
+	if n.op == "&&" && !left || n.op == "||" && left {
+		return left
+	}
+
+	right, _ := n.right.eval(env).(bool)
+	return right
+}
+
+type comparison struct {
+	op          string
+	left, right node
+}
+
+func (n comparison) eval(env *filterEnv) interface{} {
+	left, right := n.left.eval(env), n.right.eval(env)
+	switch n.op {
+	case "==":
+		return equal(left, right)
+	case "!=":
+		return !equal(left, right)
+	}
+
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return false
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return false
+	}
+
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func equal(a, b interface{}) bool {
+	switch a.(type) {
+	case nil, bool, float64, string:
+		return a == b
+	}
+
+	// objects and arrays of JSON values are never equal to a literal
+	return false
+}
+
+type call struct {
+	name string
+	args []node
+}
+
+// filterFuncs holds the number of arguments of every function.
+var filterFuncs = map[string]int{
+	"startsWith": 2,
+	"endsWith":   2,
+	"contains":   2,
+	"has":        1,
+}
+
+func (n call) eval(env *filterEnv) interface{} {
+	if n.name == "has" {
+		return n.args[0].eval(env) != nil
+	}
+
+	s, ok := n.args[0].eval(env).(string)
+	if !ok {
+		return false
+	}
+	arg, ok := n.args[1].eval(env).(string)
+	if !ok {
+		return false
+	}
+
+	switch n.name {
+	case "startsWith":
+		return strings.HasPrefix(s, arg)
+	case "endsWith":
+		return strings.HasSuffix(s, arg)
+	default:
+		return strings.Contains(s, arg)
+	}
+}
+
+type parser struct {
+	lexer lexer
+	tok   token
+	// depth is how many nested expressions are being parsed.
+	depth int
+}
+
+func (p *parser) next() {
+	p.tok = p.lexer.next()
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("filter at %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// enter counts an expression nested in the one being parsed, and leave ends
+// it.
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > maxFilterDepth {
+		return p.errorf("expressions nested deeper than %d", maxFilterDepth)
+	}
+
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) parseOr() (node, error) {
+	err := p.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.tok.is(tokenOperator, "||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{op: "||", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.tok.is(tokenOperator, "&&") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logical{op: "&&", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.tok.is(tokenOperator, "!") {
+		err := p.enter()
+		if err != nil {
+			return nil, err
+		}
+		defer p.leave()
+
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return not{operand: operand}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.tok.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		if p.tok.kind != tokenOperator {
+			break
+		}
+		op := p.tok.text
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return comparison{op: op, left: left, right: right}, nil
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokenString:
+		p.next()
+		return literal{value: tok.text}, nil
+	case tokenNumber:
+		p.next()
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", tok.text)
+		}
+		return literal{value: f}, nil
+	case tokenIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return literal{value: true}, nil
+		case "false":
+			return literal{value: false}, nil
+		case "null":
+			return literal{value: nil}, nil
+		}
+
+		if p.tok.is(tokenOperator, "(") {
+			return p.parseCall(tok.text)
+		}
+
+		return p.parseField(tok)
+	case tokenOperator:
+		if tok.text == "(" {
+			p.next()
+			expr, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.tok.is(tokenOperator, ")") {
+				return nil, p.errorf("expected ) instead of %s", p.tok)
+			}
+			p.next()
+			return expr, nil
+		}
+	}
+
+	return nil, p.errorf("unexpected %s", tok)
+}
+
+func (p *parser) parseField(name token) (node, error) {
+	switch name.text {
+	case "type", "key", "offset", "timestamp", "headers", "value":
+	default:
+		return nil, fmt.Errorf("filter at %d: unknown field %s", name.pos, name.text)
+	}
+
+	f := field{name: name.text}
+	for {
+		switch {
+		case p.tok.is(tokenOperator, "."):
+			p.next()
+			if p.tok.kind != tokenIdent {
+				return nil, p.errorf("expected a field name instead of %s", p.tok)
+			}
+			f.path = append(f.path, p.tok.text)
+			p.next()
+		case p.tok.is(tokenOperator, "["):
+			p.next()
+			if p.tok.kind != tokenString && p.tok.kind != tokenNumber {
+				return nil, p.errorf("expected a string or a number instead of %s", p.tok)
+			}
+			f.path = append(f.path, p.tok.text)
+			p.next()
+			if !p.tok.is(tokenOperator, "]") {
+				return nil, p.errorf("expected ] instead of %s", p.tok)
+			}
+			p.next()
+		default:
+			return f, nil
+		}
+	}
+}
+
+func (p *parser) parseCall(name string) (node, error) {
+	arity, ok := filterFuncs[name]
+	if !ok {
+		return nil, p.errorf("unknown function %s", name)
+	}
+	// skip the (
+	p.next()
+
+	c := call{name: name}
+	for !p.tok.is(tokenOperator, ")") {
+		if len(c.args) > 0 {
+			if !p.tok.is(tokenOperator, ",") {
+				return nil, p.errorf("expected , instead of %s", p.tok)
+			}
+			p.next()
+		}
+
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+	}
+	p.next()
+
+	if len(c.args) != arity {
+		return nil, p.errorf("%s takes %d arguments, not %d", name, arity, len(c.args))
+	}
+
+	return c, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenInvalid
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) is(kind tokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of filter"
+	case tokenString:
+		return strconv.Quote(t.text)
+	default:
+		return t.text
+	}
+}
+
+type lexer struct {
+	input string
+	pos   int
+}
+
+// operators holds the operators of two characters before the ones of one,
+// so the longest is matched.
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ".", ","}
+
+func (l *lexer) next() token {
+	for l.pos < len(l.input) && unicode.IsSpace(rune(l.input[l.pos])) {
+		l.pos++
+	}
+
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return token{kind: tokenEOF, pos: start}
+	}
+
+	c := l.input[l.pos]
+	switch {
+	case c == '"':
+		return l.string()
+	case c >= '0' && c <= '9' || c == '-':
+		l.pos++
+		for l.pos < len(l.input) && strings.IndexByte("0123456789.eE+-", l.input[l.pos]) >= 0 {
+			l.pos++
+		}
+		return token{kind: tokenNumber, text: l.input[start:l.pos], pos: start}
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for l.pos < len(l.input) && (l.input[l.pos] == '_' || unicode.IsLetter(rune(l.input[l.pos])) || unicode.IsDigit(rune(l.input[l.pos]))) {
+			l.pos++
+		}
+		return token{kind: tokenIdent, text: l.input[start:l.pos], pos: start}
+	}
+
+	for _, op := range operators {
+		if strings.HasPrefix(l.input[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokenOperator, text: op, pos: start}
+		}
+	}
+
+	l.pos++
+	return token{kind: tokenInvalid, text: string(c), pos: start}
+}
+
+// string reads a string literal with the escapes of Go.
+func (l *lexer) string() token {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.input) {
+		switch l.input[l.pos] {
+		case '\\':
+			l.pos += 2
+			continue
+		case '"':
+			l.pos++
+			s, err := strconv.Unquote(l.input[start:l.pos])
+			if err != nil {
+				return token{kind: tokenInvalid, text: l.input[start:l.pos], pos: start}
+			}
+			return token{kind: tokenString, text: s, pos: start}
+		}
+		l.pos++
+	}
+
+	return token{kind: tokenInvalid, text: l.input[start:], pos: start}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+	"github.com/huytran2000-hcmus/proglog/pkg/testhelper"
+)
+
+func TestFilter(t *testing.T) {
+	record := &api.Record{
+		Value:  []byte(`{"user": {"name": "ana", "age": 30}, "tags": ["new", "vip"]}`),
+		Offset: 7,
+		Type:   2,
+		Key:    []byte("user-42"),
+		Headers: []*api.Header{
+			{Key: "source", Value: []byte("web")},
+			{Key: "content-type", Value: []byte("application/json")},
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`type == 2`, true},
+		{`type != 2`, false},
+		{`offset >= 7 && offset < 8`, true},
+		{`startsWith(key, "user-")`, true},
+		{`endsWith(key, "-43")`, false},
+		{`headers.source == "web"`, true},
+		{`headers["content-type"] == "application/json"`, true},
+		{`has(headers.missing)`, false},
+		{`value.user.name == "ana" && value.user.age > 18`, true},
+		{`value.user.age < 18 || value.tags[1] == "vip"`, true},
+		{`value["tags"][0] == "new"`, true},
+		{`contains(value, "vip")`, true},
+		{`!(type == 2)`, false},
+		{`value.user.missing == null`, true},
+		// values of different types are never equal
+		{`value.user.age == "30"`, false},
+		{`value.user > 1`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := parseFilter(tt.expr)
+			testhelper.RequireNoError(t, err)
+			testhelper.AssertEqual(t, tt.want, f.match(record))
+		})
+	}
+
+	t.Run("nested to the limit", func(t *testing.T) {
+		depth := maxFilterDepth - 1
+		expr := strings.Repeat("(", depth) + "type == 2" + strings.Repeat(")", depth)
+		f, err := parseFilter(expr)
+		testhelper.RequireNoError(t, err)
+		testhelper.AssertEqual(t, true, f.match(record))
+	})
+
+	t.Run("value that isn't JSON", func(t *testing.T) {
+		f, err := parseFilter(`value.user == null && value == "plain"`)
+		testhelper.RequireNoError(t, err)
+		testhelper.AssertEqual(t, true, f.match(&api.Record{Value: []byte("plain")}))
+	})
+
+	for _, expr := range []string{
+		``,
+		`type ==`,
+		`(type == 2`,
+		`unknown == 2`,
+		`startsWith(key)`,
+		`missing(key)`,
+		`key == "unterminated`,
+		`type == 2 type`,
+		`key = "a"`,
+		strings.Repeat("(", maxFilterDepth) + "type == 2" + strings.Repeat(")", maxFilterDepth),
+		strings.Repeat("!", maxFilterDepth) + "true",
+		strings.Repeat("(", 3500<<10),
+		`key == "` + strings.Repeat("a", maxFilterBytes) + `"`,
+	} {
+		name := expr
+		if len(name) > 32 {
+			name = name[:32] + "..."
+		}
+		t.Run("invalid "+name, func(t *testing.T) {
+			_, err := parseFilter(expr)
+			if err == nil {
+				t.Errorf("expect an error parsing %q", expr)
+			}
+		})
+	}
+}
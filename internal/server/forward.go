@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+)
+
+// hopsMetadataKey counts how many times a request was forwarded.
+const hopsMetadataKey = "proglog-forward-hops"
+
+// defaultMaxForwardHops lets a request be forwarded once, from a follower to
+// the leader.
+const defaultMaxForwardHops = 1
+
+// Forwarder keeps a connection to every leader requests were forwarded to,
+// so they are dialed once.
+type Forwarder struct {
+	opts  []grpc.DialOption
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+func NewForwarder(opts ...grpc.DialOption) *Forwarder {
+	return &Forwarder{
+		opts:  opts,
+		conns: make(map[string]*grpc.ClientConn),
+	}
+}
+
+func (f *Forwarder) conn(addr string) (*grpc.ClientConn, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	conn, ok := f.conns[addr]
+	if ok {
+		return conn, nil
+	}
+
+	conn, err := grpc.Dial(addr, f.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("dial leader %s: %w", addr, err)
+	}
+	f.conns[addr] = conn
+
+	return conn, nil
+}
+
+func (f *Forwarder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var err error
+	for addr, conn := range f.conns {
+		err = errors.Join(err, conn.Close())
+		delete(f.conns, addr)
+	}
+
+	return err
+}
+
+// forwardInterceptor forwards the unary requests a follower failed with
+// NotLeaderError to the leader.
+func (s *grpcServer) forwardInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil, err
+	}
+
+	return s.forward(ctx, info.FullMethod, msg, err)
+}
+
+// forward sends the request to the leader if err says the server isn't the
+// leader, and returns err otherwise. Only the requests rejected before they
+// reached the raft log fail with NotLeaderError; one whose leader lost its
+// leadership may still be committed, so it isn't sent again. The leader
+// authorizes the request against the identity the servers dial each other
+// with, the caller was already authorized by this server.
+func (s *grpcServer) forward(ctx context.Context, method string, req proto.Message, err error) (interface{}, error) {
+	var notLeader api.NotLeaderError
+	if s.Forwarder == nil || !errors.As(err, &notLeader) || notLeader.Leader == "" {
+		return nil, err
+	}
+
+	hops := forwardHops(ctx)
+	maxHops := s.MaxForwardHops
+	if maxHops == 0 {
+		maxHops = defaultMaxForwardHops
+	}
+	if hops >= maxHops {
+		return nil, err
+	}
+
+	resp, respErr := newResponse(method)
+	if respErr != nil {
+		return nil, err
+	}
+
+	conn, dialErr := s.Forwarder.conn(notLeader.Leader)
+	if dialErr != nil {
+		return nil, dialErr
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, hopsMetadataKey, strconv.Itoa(hops+1))
+	err = conn.Invoke(ctx, method, req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// forwardHops returns how many times the request was forwarded to reach this
+// server.
+func forwardHops(ctx context.Context) int {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0
+	}
+
+	values := md.Get(hopsMetadataKey)
+	if len(values) == 0 {
+		return 0
+	}
+
+	hops, err := strconv.Atoi(values[0])
+	if err != nil {
+		return 0
+	}
+
+	return hops
+}
+
+// newResponse returns an empty response of the method of the Log service.
+func newResponse(method string) (proto.Message, error) {
+	svc := api.File_api_v1_log_proto.Services().ByName("Log")
+	for i := 0; i < svc.Methods().Len(); i++ {
+		m := svc.Methods().Get(i)
+		if fmt.Sprintf("/%s/%s", svc.FullName(), m.Name()) != method {
+			continue
+		}
+
+		typ, err := protoregistry.GlobalTypes.FindMessageByName(m.Output().FullName())
+		if err != nil {
+			return nil, err
+		}
+
+		return typ.New().Interface(), nil
+	}
+
+	return nil, fmt.Errorf("unknown method %s", method)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+	"github.com/huytran2000-hcmus/proglog/pkg/testhelper"
+)
+
+// countingLeader counts the produces forwarded to it.
+type countingLeader struct {
+	api.UnimplementedLogServer
+	produces atomic.Int64
+}
+
+func (l *countingLeader) Produce(context.Context, *api.ProduceRequest) (*api.ProduceResponse, error) {
+	l.produces.Add(1)
+	return &api.ProduceResponse{Offset: 1}, nil
+}
+
+func TestForward(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	testhelper.RequireNoError(t, err)
+
+	leader := &countingLeader{}
+	leaderSrv := grpc.NewServer()
+	api.RegisterLogServer(leaderSrv, leader)
+	go func() {
+		_ = leaderSrv.Serve(ln)
+	}()
+	defer leaderSrv.Stop()
+
+	forwarder := NewForwarder(grpc.WithTransportCredentials(insecure.NewCredentials()))
+	defer forwarder.Close()
+
+	s := &grpcServer{Config: &Config{Forwarder: forwarder}}
+	info := &grpc.UnaryServerInfo{FullMethod: api.Log_Produce_FullMethodName}
+	req := &api.ProduceRequest{Record: &api.Record{Value: []byte("hello")}}
+	failWith := func(err error) grpc.UnaryHandler {
+		return func(context.Context, interface{}) (interface{}, error) {
+			return nil, err
+		}
+	}
+
+	// a produce rejected before it reached the raft log goes to the leader
+	resp, err := s.forwardInterceptor(context.Background(), req, info, failWith(api.NotLeaderError{Leader: ln.Addr().String()}))
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(1), resp.(*api.ProduceResponse).Offset)
+	testhelper.AssertEqual(t, int64(1), leader.produces.Load())
+
+	// a produce the leader lost its leadership with may still be committed
+	_, err = s.forwardInterceptor(context.Background(), req, info, failWith(api.LeadershipLostError{}))
+	testhelper.AssertEqual(t, codes.Unavailable, status.Code(err))
+	testhelper.AssertEqual(t, int64(1), leader.produces.Load())
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+)
+
+// maxHTTPBodyBytes keeps a request body below the default maximum size of a
+// gRPC message, which the request would be otherwise.
+const maxHTTPBodyBytes = 4 << 20
+
+// NewHTTPHandler returns the HTTP/JSON API of the log. Its endpoints take
+// the requests of the gRPC methods of the same name as a JSON body, in the
+// JSON mapping of protobuf, and serve them like the gRPC server built from
+// the same config:
+//
+//	POST /v1/produce        Produce
+//	POST /v1/consume        Consume
+//	POST /v1/consume-range  ConsumeRange
+//	POST /v1/offsets        GetOffsets
+//	GET  /v1/servers        GetServers
+//	GET  /v1/tail           ConsumeStream, as Server-Sent Events or a WebSocket
+//
+// The caller is authorized as the common name of its client certificate.
+// Since browsers present it to any site's requests, the POST endpoints only
+// take an application/json body, which a page of another site can't send
+// without the consent of the server.
+func NewHTTPHandler(config *Config) (http.Handler, error) {
+	srv, err := newGRPCServer(config)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/produce", handle(srv, http.MethodPost, api.Log_Produce_FullMethodName, srv.Produce))
+	mux.Handle("/v1/consume", handle(srv, http.MethodPost, api.Log_Consume_FullMethodName, srv.Consume))
+	mux.Handle("/v1/consume-range", handle(srv, http.MethodPost, api.Log_ConsumeRange_FullMethodName, srv.ConsumeRange))
+	mux.Handle("/v1/offsets", handle(srv, http.MethodPost, api.Log_GetOffsets_FullMethodName, srv.GetOffsets))
+	mux.Handle("/v1/servers", handle(srv, http.MethodGet, api.Log_GetServers_FullMethodName, srv.GetServers))
+	mux.HandleFunc("/v1/tail", srv.tail)
+
+	return mux, nil
+}
+
+// handle serves the gRPC method from HTTP. A request a follower can't serve
+// is forwarded to the leader like the gRPC ones are.
+func handle[Req, Res proto.Message](
+	s *grpcServer,
+	httpMethod, grpcMethod string,
+	call func(context.Context, Req) (Res, error),
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != httpMethod {
+			w.Header().Set("Allow", httpMethod)
+			writeHTTPError(w, status.Error(codes.Unimplemented, "method not allowed"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if httpMethod != http.MethodGet && !isJSON(r.Header.Get("Content-Type")) {
+			writeHTTPError(w, status.Error(codes.InvalidArgument, "the body must be application/json"), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		var req Req
+		req = req.ProtoReflect().Type().New().Interface().(Req)
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxHTTPBodyBytes))
+		if err != nil {
+			writeHTTPError(w, status.Errorf(codes.InvalidArgument, "read body: %s", err), 0)
+			return
+		}
+
+		if len(body) > 0 {
+			err = protojson.Unmarshal(body, req)
+			if err != nil {
+				writeHTTPError(w, status.Errorf(codes.InvalidArgument, "decode body: %s", err), 0)
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), subjectContextKey{}, tlsSubject(r.TLS))
+		var res interface{}
+		res, err = call(ctx, req)
+		if err != nil {
+			res, err = s.forward(ctx, grpcMethod, req, err)
+		}
+		if err != nil {
+			writeHTTPError(w, err, 0)
+			return
+		}
+
+		b, err := protojson.Marshal(res.(proto.Message))
+		if err != nil {
+			writeHTTPError(w, status.Errorf(codes.Internal, "encode response: %s", err), 0)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	})
+}
+
+// isJSON reports whether the content type is application/json.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// writeHTTPError writes the gRPC status of err as JSON, with the HTTP status
+// matching its code unless code is given.
+func writeHTTPError(w http.ResponseWriter, err error, code int) {
+	if code == 0 {
+		code = httpStatus(status.Code(err))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(httpErrorBody(err))
+}
+
+// httpErrorBody returns the gRPC status of err as JSON.
+func httpErrorBody(err error) []byte {
+	st := status.Convert(err)
+	b, _ := json.Marshal(struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{
+		Code:    st.Code().String(),
+		Message: st.Message(),
+	})
+
+	return b
+}
+
+// httpStatus maps a gRPC code onto the HTTP status gRPC gateways use for it.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// tlsSubject returns the common name of the verified client certificate of
+// the connection, or an empty subject without one.
+func tlsSubject(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
@@ -2,8 +2,13 @@ package server
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"sync/atomic"
+	"time"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
@@ -18,34 +23,99 @@ import (
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	api "github.com/huytran2000-hcmus/proglog/api/v1"
 )
 
 const (
-	produceAction  = "produce"
-	consumeAction  = "consume"
-	objectWildCard = "*"
+	produceAction = "produce"
+	consumeAction = "consume"
+	adminAction   = "admin"
 )
 
 const (
 	serverName = "proglog"
 )
 
+// the limits of the pages of ConsumeRange, the caps keep a page below the
+// default maximum size of a gRPC message
+const (
+	defaultRangeRecords uint32 = 100
+	maxRangeRecords     uint32 = 1000
+	defaultRangeBytes   uint64 = 1 << 20
+	maxRangeBytes       uint64 = 3 << 20
+)
+
 type grpcServer struct {
 	api.UnimplementedLogServer
 	*Config
+	// next is the counter keyless records are spread across partitions with
+	next uint64
 }
 
 type Config struct {
 	CommitLog   CommitLog
 	Authorizer  Authorizer
 	GetServerer GetServerer
+	// LongPollTimeout ends a ConsumeStream that waited this long for a new
+	// record, so the client can reconnect from its last offset. Zero waits
+	// for as long as the stream is open.
+	LongPollTimeout time.Duration
+	// Forwarder sends the requests only the leader serves to it when they
+	// reach a follower. They fail with the leader's address when it's nil.
+	Forwarder *Forwarder
+	// MaxForwardHops is how many times a request may be forwarded, so it
+	// can't go around while the servers disagree on the leader. Zero
+	// forwards once.
+	MaxForwardHops int
+	// AllowedOrigins are the origins, like https://dashboard.example.com,
+	// that browsers may open a WebSocket to the HTTP API from besides the
+	// host of the server itself.
+	AllowedOrigins []string
 }
 
+// CommitLog holds the records of every partition of every topic. An empty
+// topic names the default one.
 type CommitLog interface {
-	Append(*api.Record) (uint64, error)
-	Read(uint64) (*api.Record, error)
+	// Append and AppendBatch append to the partition set in the request.
+	Append(*api.ProduceRequest) (uint64, error)
+	AppendBatch(*api.ProduceBatchRequest) (uint64, error)
+	Read(string, uint32, uint64) (*api.Record, error)
+	// Wait blocks until the record at the offset is appended to the
+	// partition or the context is done.
+	Wait(context.Context, string, uint32, uint64) error
+	// ReadCommitted and WaitCommitted are Read and Wait for read_committed
+	// consumers, who skip the records of aborted transactions and wait for
+	// the open ones to end.
+	ReadCommitted(string, uint32, uint64) (*api.Record, error)
+	WaitCommitted(context.Context, string, uint32, uint64) error
+	// VerifyRead returns an error unless the server can serve reads of the
+	// consistency.
+	VerifyRead(api.Consistency) error
+	OffsetForTime(string, uint32, time.Time) (uint64, error)
+	GetOffsets(string, uint32) (*api.GetOffsetsResponse, error)
+	Partitions(string) (uint32, error)
+	CreateTopic(string, uint32) error
+	DeleteTopic(string) error
+	ListTopics() ([]string, error)
+	// CommitOffset stores the next offset a consumer group consumes from a
+	// partition.
+	CommitOffset(*api.CommitOffsetRequest) error
+	CommittedOffset(group, topic string, partition uint32) (uint64, error)
+	// JoinGroup adds a consumer to a group and assigns it partitions of the
+	// topic the group consumes.
+	JoinGroup(*api.JoinGroupRequest) (*api.JoinGroupResponse, error)
+	Heartbeat(group, topic, memberID string, generation uint64) error
+	LeaveGroup(group, topic, memberID string) error
+	// InitProducer hands out the producer ID and epoch of an idempotent
+	// producer.
+	InitProducer(*api.InitProducerRequest) (*api.InitProducerResponse, error)
+	// BeginTxn opens a transaction of an idempotent producer, which only
+	// the producer can produce in, commit and abort.
+	BeginTxn(*api.BeginTxnRequest) (uint64, error)
+	CommitTxn(*api.CommitTxnRequest) error
+	AbortTxn(*api.AbortTxnRequest) error
 }
 
 type Authorizer interface {
@@ -66,6 +136,11 @@ func NewGRPCServer(config *Config, opts ...grpc.ServerOption) (*grpc.Server, err
 		grpc_zap.WithDurationField(grpc_zap.DurationToTimeMillisField),
 	}
 
+	srv, err := newGRPCServer(config)
+	if err != nil {
+		return nil, fmt.Errorf("create new grpc log server: %w", err)
+	}
+
 	opts = append(opts,
 		grpc.StreamInterceptor(
 			grpc_middleware.ChainStreamServer(
@@ -79,6 +154,7 @@ func NewGRPCServer(config *Config, opts ...grpc.ServerOption) (*grpc.Server, err
 				grpc_ctxtags.UnaryServerInterceptor(),
 				grpc_zap.UnaryServerInterceptor(logger, zapOpts...),
 				grpc_auth.UnaryServerInterceptor(authenticate),
+				srv.forwardInterceptor,
 			),
 		),
 		grpc.StatsHandler(otelgrpc.NewServerHandler()),
@@ -89,11 +165,6 @@ func NewGRPCServer(config *Config, opts ...grpc.ServerOption) (*grpc.Server, err
 	hsrv.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
 	grpc_health_v1.RegisterHealthServer(grpcSrv, hsrv)
 
-	srv, err := newGRPCServer(config)
-	if err != nil {
-		return nil, fmt.Errorf("create new grpc log server: %w", err)
-	}
-
 	api.RegisterLogServer(grpcSrv, srv)
 
 	return grpcSrv, nil
@@ -106,29 +177,155 @@ func newGRPCServer(config *Config) (*grpcServer, error) {
 }
 
 func (s *grpcServer) Produce(ctx context.Context, req *api.ProduceRequest) (*api.ProduceResponse, error) {
-	err := s.Authorizer.Authorize(subject(ctx), objectWildCard, produceAction)
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Topic), produceAction)
 	if err != nil {
 		return nil, fmt.Errorf("failed authorization: %w", err)
 	}
-	offset, err := s.CommitLog.Append(req.Record)
+
+	if req.Record == nil {
+		return nil, status.Error(codes.InvalidArgument, "produce has no record")
+	}
+
+	partition := req.GetPartition()
+	if req.Partition == nil {
+		partition, err = s.partition(req.Topic, req.Record, req.ProducerId, req.Sequence)
+		if err != nil {
+			return nil, err
+		}
+		req.Partition = &partition
+	}
+
+	offset, err := s.CommitLog.Append(req)
 	if err != nil {
 		return nil, fmt.Errorf("produce a record: %w", err)
 	}
 
 	resp := &api.ProduceResponse{
-		Offset: offset,
+		Offset:    offset,
+		Partition: partition,
+	}
+
+	return resp, nil
+}
+
+func (s *grpcServer) ProduceBatch(ctx context.Context, req *api.ProduceBatchRequest) (*api.ProduceBatchResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Topic), produceAction)
+	if err != nil {
+		return nil, fmt.Errorf("failed authorization: %w", err)
+	}
+
+	if len(req.Records) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "produce batch has no records")
+	}
+
+	for i, record := range req.Records {
+		if record == nil {
+			return nil, status.Errorf(codes.InvalidArgument, "record %d of the produce batch is empty", i)
+		}
+	}
+
+	// the records of each partition are appended together, in the order of
+	// the batch, numbered with the sequence number of their first record
+	var partitions []uint32
+	batches := make(map[uint32]*api.ProduceBatchRequest)
+	for i, record := range req.Records {
+		sequence := req.Sequence + uint64(i)
+		partition := req.GetPartition()
+		if req.Partition == nil {
+			partition, err = s.partition(req.Topic, record, req.ProducerId, sequence)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		batch, ok := batches[partition]
+		if !ok {
+			batch = &api.ProduceBatchRequest{
+				Topic:         req.Topic,
+				Partition:     &partition,
+				ProducerId:    req.ProducerId,
+				ProducerEpoch: req.ProducerEpoch,
+				Sequence:      sequence,
+				TxnId:         req.TxnId,
+				Acks:          req.Acks,
+			}
+			batches[partition] = batch
+			partitions = append(partitions, partition)
+		}
+		batch.Records = append(batch.Records, record)
+	}
+
+	resp := &api.ProduceBatchResponse{}
+	for _, partition := range partitions {
+		batch := batches[partition]
+		offset, err := s.CommitLog.AppendBatch(batch)
+		if err != nil {
+			return nil, fmt.Errorf("produce a batch of records to partition %d: %w", partition, err)
+		}
+
+		offsets := &api.PartitionOffsets{Partition: partition}
+		if req.Acks == api.Acks_ALL {
+			offsets.FirstOffset = offset
+			offsets.LastOffset = offset + uint64(len(batch.Records)) - 1
+		}
+		resp.Partitions = append(resp.Partitions, offsets)
+	}
+
+	if len(resp.Partitions) == 1 {
+		resp.FirstOffset = resp.Partitions[0].FirstOffset
+		resp.LastOffset = resp.Partitions[0].LastOffset
 	}
 
 	return resp, nil
 }
 
+// partition returns the partition of the topic the record is produced to.
+// Records with the same key go to the same partition, so they stay in order,
+// and keyless records are spread round-robin. The keyless records of an
+// idempotent producer are spread by their sequence number instead, so a
+// retried record goes to the partition it was first appended to.
+func (s *grpcServer) partition(topic string, record *api.Record, producerID, sequence uint64) (uint32, error) {
+	n, err := s.CommitLog.Partitions(topic)
+	if err != nil {
+		return 0, err
+	}
+
+	h := fnv.New32a()
+	switch {
+	case len(record.GetKey()) > 0:
+		_, _ = h.Write(record.Key)
+	case producerID != 0:
+		b := binary.BigEndian.AppendUint64(nil, producerID)
+		_, _ = h.Write(binary.BigEndian.AppendUint64(b, sequence))
+	default:
+		return uint32(atomic.AddUint64(&s.next, 1) % uint64(n)), nil
+	}
+
+	return h.Sum32() % n, nil
+}
+
 func (s *grpcServer) Consume(ctx context.Context, req *api.ConsumeRequest) (*api.ConsumeResponse, error) {
-	err := s.Authorizer.Authorize(subject(ctx), objectWildCard, consumeAction)
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Topic), consumeAction)
 	if err != nil {
 		return nil, fmt.Errorf("failed authorization: %w", err)
 	}
 
-	record, err := s.CommitLog.Read(req.Offset)
+	err = consumable(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.CommitLog.VerifyRead(req.Consistency)
+	if err != nil {
+		return nil, err
+	}
+
+	read := s.CommitLog.Read
+	if req.Isolation == api.IsolationLevel_READ_COMMITTED {
+		read = s.CommitLog.ReadCommitted
+	}
+
+	record, err := read(req.Topic, req.Partition, req.Offset)
 	if err != nil {
 		return nil, err
 	}
@@ -140,6 +337,67 @@ func (s *grpcServer) Consume(ctx context.Context, req *api.ConsumeRequest) (*api
 	return resp, nil
 }
 
+// ConsumeRange returns a page of the records of the partition, so the
+// history can be scanned without a stream held open.
+func (s *grpcServer) ConsumeRange(ctx context.Context, req *api.ConsumeRangeRequest) (*api.ConsumeRangeResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Topic), consumeAction)
+	if err != nil {
+		return nil, fmt.Errorf("failed authorization: %w", err)
+	}
+
+	err = consumable(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.CommitLog.VerifyRead(req.Consistency)
+	if err != nil {
+		return nil, err
+	}
+
+	read := s.CommitLog.Read
+	if req.Isolation == api.IsolationLevel_READ_COMMITTED {
+		read = s.CommitLog.ReadCommitted
+	}
+
+	maxRecords := req.MaxRecords
+	if maxRecords == 0 {
+		maxRecords = defaultRangeRecords
+	}
+	maxRecords = min(maxRecords, maxRangeRecords)
+
+	maxBytes := req.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = defaultRangeBytes
+	}
+	maxBytes = min(maxBytes, maxRangeBytes)
+
+	res := &api.ConsumeRangeResponse{NextOffset: req.Offset}
+	var size uint64
+	for uint32(len(res.Records)) < maxRecords {
+		record, err := read(req.Topic, req.Partition, res.NextOffset)
+		var rangeErr api.OffsetOutOfRangeError
+		if errors.As(err, &rangeErr) && rangeErr.Offset >= rangeErr.Lowest {
+			// the end of the partition
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		size += uint64(proto.Size(record))
+		if size > maxBytes && len(res.Records) > 0 {
+			break
+		}
+
+		res.Records = append(res.Records, record)
+		// compaction leaves gaps between offsets
+		res.NextOffset = record.Offset + 1
+	}
+
+	return res, nil
+}
+
 func (s *grpcServer) ProduceStream(stream api.Log_ProduceStreamServer) error {
 	for {
 		req, err := stream.Recv()
@@ -153,7 +411,11 @@ func (s *grpcServer) ProduceStream(stream api.Log_ProduceStreamServer) error {
 
 		resp, err := s.Produce(stream.Context(), req)
 		if err != nil {
-			return fmt.Errorf("produce from request: %w", err)
+			forwarded, err := s.forward(stream.Context(), api.Log_Produce_FullMethodName, req, err)
+			if err != nil {
+				return fmt.Errorf("produce from request: %w", err)
+			}
+			resp = forwarded.(*api.ProduceResponse)
 		}
 
 		err = stream.Send(resp)
@@ -166,28 +428,337 @@ func (s *grpcServer) ProduceStream(stream api.Log_ProduceStreamServer) error {
 }
 
 func (s *grpcServer) ConsumeStream(req *api.ConsumeRequest, stream api.Log_ConsumeStreamServer) error {
+	err := s.Authorizer.Authorize(subject(stream.Context()), object(req.Topic), consumeAction)
+	if err != nil {
+		return fmt.Errorf("failed authorization: %w", err)
+	}
+
+	err = consumable(req.Topic)
+	if err != nil {
+		return err
+	}
+
+	f, err := newFilter(req.Filter)
+	if err != nil {
+		return err
+	}
+
+	return s.follow(stream.Context(), req, f, stream.Send)
+}
+
+// newFilter parses the filter expression of a request, if any.
+func newFilter(expr string) (*filter, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	f, err := parseFilter(expr)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return f, nil
+}
+
+// follow sends the records matching the filter from the offset of the
+// request on, as they're appended, until the context is done or the
+// long-poll timeout passes without a new record. The caller authorizes the
+// request once for the stream. The consistency is verified each time the
+// stream wakes up, then the records appended meanwhile are read straight
+// from the log.
+func (s *grpcServer) follow(ctx context.Context, req *api.ConsumeRequest, f *filter, send func(*api.ConsumeResponse) error) error {
+	read := s.CommitLog.Read
+	if req.Isolation == api.IsolationLevel_READ_COMMITTED {
+		read = s.CommitLog.ReadCommitted
+	}
+
 	for {
-		select {
-		case <-stream.Context().Done():
+		ok, err := s.wait(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
 			return nil
-		default:
-			res, err := s.Consume(stream.Context(), req)
-
-			switch err.(type) {
-			case nil:
-			case api.OffsetOutOfRangeError:
-				continue
-			default:
-				return err
-			}
+		}
 
-			err = stream.Send(res)
+		err = s.CommitLog.VerifyRead(req.Consistency)
+		if err != nil {
+			return err
+		}
+
+		for ctx.Err() == nil {
+			record, err := read(req.Topic, req.Partition, req.Offset)
+			var outOfRange api.OffsetOutOfRangeError
+			if errors.As(err, &outOfRange) && outOfRange.Offset >= outOfRange.Lowest {
+				// caught up, wait for the next record
+				break
+			}
 			if err != nil {
 				return err
 			}
-			req.Offset++
+
+			if f == nil || f.match(record) {
+				err = send(&api.ConsumeResponse{Record: record})
+				if err != nil {
+					return err
+				}
+			}
+			// compaction leaves gaps between offsets
+			req.Offset = record.Offset + 1
+		}
+	}
+}
+
+// wait blocks until the record at the offset of the request is appended to
+// the partition, or committed for read_committed requests. It returns false
+// if the stream ended or the long-poll timeout passed first.
+func (s *grpcServer) wait(ctx context.Context, req *api.ConsumeRequest) (bool, error) {
+	waitCtx := ctx
+	if s.LongPollTimeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, s.LongPollTimeout)
+		defer cancel()
+	}
+
+	wait := s.CommitLog.Wait
+	if req.Isolation == api.IsolationLevel_READ_COMMITTED {
+		wait = s.CommitLog.WaitCommitted
+	}
+
+	err := wait(waitCtx, req.Topic, req.Partition, req.Offset)
+	if err != nil {
+		if waitCtx.Err() != nil {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("wait for offset %d: %w", req.Offset, err)
+	}
+
+	return true, nil
+}
+
+func (s *grpcServer) OffsetsForTime(ctx context.Context, req *api.OffsetsForTimeRequest) (*api.OffsetsForTimeResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Topic), consumeAction)
+	if err != nil {
+		return nil, fmt.Errorf("failed authorization: %w", err)
+	}
+
+	err = consumable(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := s.CommitLog.OffsetForTime(req.Topic, req.Partition, time.Unix(0, req.Timestamp))
+	if err != nil {
+		return nil, fmt.Errorf("find offset for time: %w", err)
+	}
+
+	return &api.OffsetsForTimeResponse{
+		Offset: offset,
+	}, nil
+}
+
+// GetOffsets returns the range of offsets of the partition on this server,
+// so consumers can start from the earliest or the latest record and
+// monitoring can compute their lag.
+func (s *grpcServer) GetOffsets(ctx context.Context, req *api.GetOffsetsRequest) (*api.GetOffsetsResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Topic), consumeAction)
+	if err != nil {
+		return nil, fmt.Errorf("failed authorization: %w", err)
+	}
+
+	err = consumable(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.CommitLog.GetOffsets(req.Topic, req.Partition)
+	if err != nil {
+		return nil, fmt.Errorf("get offsets: %w", err)
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) CreateTopic(ctx context.Context, req *api.CreateTopicRequest) (*api.CreateTopicResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Name), adminAction)
+	if err != nil {
+		return nil, fmt.Errorf("failed authorization: %w", err)
+	}
+
+	err = s.CommitLog.CreateTopic(req.Name, req.Partitions)
+	if err != nil {
+		return nil, fmt.Errorf("create topic: %w", err)
+	}
+
+	return &api.CreateTopicResponse{}, nil
+}
+
+func (s *grpcServer) DeleteTopic(ctx context.Context, req *api.DeleteTopicRequest) (*api.DeleteTopicResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Name), adminAction)
+	if err != nil {
+		return nil, fmt.Errorf("failed authorization: %w", err)
+	}
+
+	err = s.CommitLog.DeleteTopic(req.Name)
+	if err != nil {
+		return nil, fmt.Errorf("delete topic: %w", err)
+	}
+
+	return &api.DeleteTopicResponse{}, nil
+}
+
+// ListTopics returns the topics the caller may consume from.
+func (s *grpcServer) ListTopics(ctx context.Context, req *api.ListTopicsRequest) (*api.ListTopicsResponse, error) {
+	topics, err := s.CommitLog.ListTopics()
+	if err != nil {
+		return nil, fmt.Errorf("list topics: %w", err)
+	}
+
+	res := &api.ListTopicsResponse{Partitions: make(map[string]uint32)}
+	for _, topic := range topics {
+		if api.IsInternalTopic(topic) || s.Authorizer.Authorize(subject(ctx), topic, consumeAction) != nil {
+			continue
 		}
+
+		partitions, err := s.CommitLog.Partitions(topic)
+		if err != nil {
+			// the topic was deleted since it was listed
+			continue
+		}
+
+		res.Topics = append(res.Topics, topic)
+		res.Partitions[topic] = partitions
 	}
+
+	return res, nil
+}
+
+// CommitOffset stores the offset a consumer group resumes consuming the
+// partition from, on any node.
+func (s *grpcServer) CommitOffset(ctx context.Context, req *api.CommitOffsetRequest) (*api.CommitOffsetResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Topic), consumeAction)
+	if err != nil {
+		return nil, fmt.Errorf("failed authorization: %w", err)
+	}
+
+	if req.Group == "" {
+		return nil, status.Error(codes.InvalidArgument, "commit offset has no group")
+	}
+
+	err = s.CommitLog.CommitOffset(req)
+	if err != nil {
+		return nil, fmt.Errorf("commit offset: %w", err)
+	}
+
+	return &api.CommitOffsetResponse{}, nil
+}
+
+func (s *grpcServer) FetchCommittedOffset(ctx context.Context, req *api.FetchCommittedOffsetRequest) (*api.FetchCommittedOffsetResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Topic), consumeAction)
+	if err != nil {
+		return nil, fmt.Errorf("failed authorization: %w", err)
+	}
+
+	offset, err := s.CommitLog.CommittedOffset(req.Group, req.Topic, req.Partition)
+	if err != nil {
+		return nil, fmt.Errorf("fetch committed offset: %w", err)
+	}
+
+	return &api.FetchCommittedOffsetResponse{Offset: offset}, nil
+}
+
+func (s *grpcServer) JoinGroup(ctx context.Context, req *api.JoinGroupRequest) (*api.JoinGroupResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Topic), consumeAction)
+	if err != nil {
+		return nil, fmt.Errorf("failed authorization: %w", err)
+	}
+
+	if req.Group == "" {
+		return nil, status.Error(codes.InvalidArgument, "join group has no group")
+	}
+
+	res, err := s.CommitLog.JoinGroup(req)
+	if err != nil {
+		return nil, fmt.Errorf("join group: %w", err)
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) Heartbeat(ctx context.Context, req *api.HeartbeatRequest) (*api.HeartbeatResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Topic), consumeAction)
+	if err != nil {
+		return nil, fmt.Errorf("failed authorization: %w", err)
+	}
+
+	err = s.CommitLog.Heartbeat(req.Group, req.Topic, req.MemberId, req.Generation)
+	if err != nil {
+		return nil, fmt.Errorf("heartbeat: %w", err)
+	}
+
+	return &api.HeartbeatResponse{}, nil
+}
+
+func (s *grpcServer) LeaveGroup(ctx context.Context, req *api.LeaveGroupRequest) (*api.LeaveGroupResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), object(req.Topic), consumeAction)
+	if err != nil {
+		return nil, fmt.Errorf("failed authorization: %w", err)
+	}
+
+	err = s.CommitLog.LeaveGroup(req.Group, req.Topic, req.MemberId)
+	if err != nil {
+		return nil, fmt.Errorf("leave group: %w", err)
+	}
+
+	return &api.LeaveGroupResponse{}, nil
+}
+
+// InitProducer isn't authorized against a topic: a producer may produce to
+// any topic, and its records are authorized against theirs as they are
+// produced.
+func (s *grpcServer) InitProducer(ctx context.Context, req *api.InitProducerRequest) (*api.InitProducerResponse, error) {
+	res, err := s.CommitLog.InitProducer(req)
+	if err != nil {
+		return nil, fmt.Errorf("init producer: %w", err)
+	}
+
+	return res, nil
+}
+
+// BeginTxn, CommitTxn and AbortTxn aren't authorized against a topic either,
+// the records of the transaction are as they are produced. A transaction
+// can only be ended by the producer that began it.
+func (s *grpcServer) BeginTxn(ctx context.Context, req *api.BeginTxnRequest) (*api.BeginTxnResponse, error) {
+	if req.ProducerId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "transactions need the ID of an idempotent producer")
+	}
+
+	id, err := s.CommitLog.BeginTxn(req)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+
+	return &api.BeginTxnResponse{TxnId: id}, nil
+}
+
+func (s *grpcServer) CommitTxn(ctx context.Context, req *api.CommitTxnRequest) (*api.CommitTxnResponse, error) {
+	err := s.CommitLog.CommitTxn(req)
+	if err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return &api.CommitTxnResponse{}, nil
+}
+
+func (s *grpcServer) AbortTxn(ctx context.Context, req *api.AbortTxnRequest) (*api.AbortTxnResponse, error) {
+	err := s.CommitLog.AbortTxn(req)
+	if err != nil {
+		return nil, fmt.Errorf("abort transaction: %w", err)
+	}
+
+	return &api.AbortTxnResponse{}, nil
 }
 
 func (s *grpcServer) GetServers(ctx context.Context, req *api.GetServersRequest) (*api.GetServersResponse, error) {
@@ -212,12 +783,30 @@ func authenticate(ctx context.Context) (context.Context, error) {
 	}
 
 	tlsInfo := peer.AuthInfo.(credentials.TLSInfo)
-	subject := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
-	ctx = context.WithValue(ctx, subjectContextKey{}, subject)
+	ctx = context.WithValue(ctx, subjectContextKey{}, tlsSubject(&tlsInfo.State))
 
 	return ctx, nil
 }
 
+// object is the topic a request is authorized against.
+func object(topic string) string {
+	if topic == "" {
+		return api.DefaultTopic
+	}
+
+	return topic
+}
+
+// consumable rejects the internal topics, whose records only the nodes
+// read.
+func consumable(topic string) error {
+	if api.IsInternalTopic(topic) {
+		return api.InvalidTopicError{Topic: topic, Reason: "internal topics can't be consumed"}
+	}
+
+	return nil
+}
+
 func subject(ctx context.Context) string {
 	return ctx.Value(subjectContextKey{}).(string)
 }
@@ -1,12 +1,18 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"flag"
+	"fmt"
+	"io"
 	"net"
 	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -55,6 +61,102 @@ func TestGRPCServer(t *testing.T) {
 		testProduceConsumeStream(t, rootClient)
 	})
 
+	t.Run("consume stream waits for records", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testConsumeStreamWait(t, rootClient)
+	})
+
+	t.Run("consume stream filter", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testConsumeStreamFilter(t, rootClient)
+	})
+
+	t.Run("consume stream authorizes once", func(t *testing.T) {
+		authorizer := &countingAuthorizer{}
+		rootClient, _, teardown := setupServer(t, func(c *Config) {
+			authorizer.Authorizer = c.Authorizer
+			c.Authorizer = authorizer
+		})
+		defer teardown()
+		testConsumeStreamAuthorizeOnce(t, rootClient, authorizer)
+	})
+
+	t.Run("consume stream long-poll timeout", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t, func(c *Config) {
+			c.LongPollTimeout = 100 * time.Millisecond
+		})
+		defer teardown()
+		testConsumeStreamLongPoll(t, rootClient)
+	})
+
+	t.Run("produce batch", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testProduceBatch(t, rootClient)
+	})
+
+	t.Run("offsets for time", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testOffsetsForTime(t, rootClient)
+	})
+
+	t.Run("consume range", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testConsumeRange(t, rootClient)
+	})
+
+	t.Run("get offsets", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testGetOffsets(t, rootClient)
+	})
+
+	t.Run("topics", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testTopics(t, rootClient)
+	})
+
+	t.Run("partitions", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testPartitions(t, rootClient)
+	})
+
+	t.Run("committed offsets", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testCommittedOffsets(t, rootClient)
+	})
+
+	t.Run("consumer groups", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testConsumerGroups(t, rootClient)
+	})
+
+	t.Run("idempotent producer", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testIdempotentProducer(t, rootClient)
+	})
+
+	t.Run("leader acks", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testLeaderAcks(t, rootClient)
+	})
+
+	t.Run("transactions", func(t *testing.T) {
+		rootClient, _, teardown := setupServer(t)
+		defer teardown()
+		testTransactions(t, rootClient)
+	})
+
 	t.Run("unauthorized client", func(t *testing.T) {
 		_, nobodyClient, teardown := setupServer(t)
 		defer teardown()
@@ -84,6 +186,14 @@ func testProduceConsume(t *testing.T, client api.LogClient) {
 
 	testhelper.AssertEqual(t, want.Value, consumeResp.Record.Value)
 	testhelper.AssertEqual(t, want.Offset, consumeResp.Record.Offset)
+
+	consumeReq.Consistency = api.Consistency_LINEARIZABLE
+	consumeResp, err = client.Consume(ctx, consumeReq)
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, want.Value, consumeResp.Record.Value)
+
+	_, err = client.Produce(ctx, &api.ProduceRequest{TxnId: 1})
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
 }
 
 func testConsumePastBoundary(t *testing.T, client api.LogClient) {
@@ -107,7 +217,7 @@ func testConsumePastBoundary(t *testing.T, client api.LogClient) {
 	testhelper.AssertEqual(t, wantCode, gotCode)
 }
 
-func setupServer(t *testing.T) (rootClient api.LogClient, nobodyClient api.LogClient, teardown func()) {
+func setupServer(t *testing.T, fns ...func(*Config)) (rootClient api.LogClient, nobodyClient api.LogClient, teardown func()) {
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	testhelper.AssertNoError(t, err)
 
@@ -120,9 +230,24 @@ func setupServer(t *testing.T) (rootClient api.LogClient, nobodyClient api.LogCl
 	dir, err := os.MkdirTemp(os.TempDir(), "server-test")
 	testhelper.AssertNoError(t, err)
 
-	log, err := log.New(dir, log.Config{})
+	raftLn, err := net.Listen("tcp", "127.0.0.1:0")
 	testhelper.AssertNoError(t, err)
 
+	var logConfig log.Config
+	logConfig.Raft.Stream = log.NewStreamLayer(raftLn, nil, nil)
+	logConfig.Raft.LocalID = "0"
+	logConfig.Raft.HeartbeatTimeout = 50 * time.Millisecond
+	logConfig.Raft.ElectionTimeout = 50 * time.Millisecond
+	logConfig.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+	logConfig.Raft.CommitTimeout = 5 * time.Millisecond
+	logConfig.Raft.BindAddr = raftLn.Addr().String()
+	logConfig.Raft.Bootstrap = true
+	commitLog, err := log.NewDistributed(dir, logConfig)
+	testhelper.RequireNoError(t, err)
+
+	err = commitLog.WaitForLeader(10 * time.Second)
+	testhelper.RequireNoError(t, err)
+
 	authorizer := auth.New(config.ACLModelFile, config.ACLPolicyFile)
 
 	var shutdownOtel func(context.Context) error
@@ -132,9 +257,12 @@ func setupServer(t *testing.T) (rootClient api.LogClient, nobodyClient api.LogCl
 	}
 
 	cfg := &Config{
-		CommitLog:  log,
+		CommitLog:  commitLog,
 		Authorizer: authorizer,
 	}
+	for _, fn := range fns {
+		fn(cfg)
+	}
 
 	serverTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
 		CertFile:      config.ServerCertFile,
@@ -158,8 +286,8 @@ func setupServer(t *testing.T) (rootClient api.LogClient, nobodyClient api.LogCl
 		nobodyClientConn.Close()
 		server.Stop()
 		l.Close()
-		log.Remove()
-		os.Remove(dir)
+		commitLog.Close()
+		os.RemoveAll(dir)
 
 		if shutdownOtel != nil {
 			shutdownOtel(context.Background())
@@ -209,6 +337,633 @@ func testProduceConsumeStream(t *testing.T, client api.LogClient) {
 	}
 }
 
+func testConsumeStreamWait(t *testing.T, client api.LogClient) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0})
+	testhelper.RequireNoError(t, err)
+
+	want := []byte("hello world")
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: want},
+		})
+	}()
+
+	resp, err := stream.Recv()
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(0), resp.Record.Offset)
+	testhelper.AssertEqual(t, want, resp.Record.Value)
+}
+
+func testConsumeStreamFilter(t *testing.T, client api.LogClient) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := client.ProduceBatch(ctx, &api.ProduceBatchRequest{
+		Records: []*api.Record{
+			{Key: []byte("order-1"), Value: []byte("first")},
+			{Key: []byte("user-1"), Value: []byte("second")},
+			{Key: []byte("order-2"), Value: []byte("third")},
+		},
+	})
+	testhelper.RequireNoError(t, err)
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Filter: `startsWith(key, "order-")`})
+	testhelper.RequireNoError(t, err)
+
+	for _, want := range []uint64{0, 2} {
+		resp, err := stream.Recv()
+		testhelper.RequireNoError(t, err)
+		testhelper.AssertEqual(t, want, resp.Record.Offset)
+	}
+
+	stream, err = client.ConsumeStream(ctx, &api.ConsumeRequest{Filter: `key ==`})
+	testhelper.RequireNoError(t, err)
+	_, err = stream.Recv()
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
+}
+
+// countingAuthorizer counts the consume authorizations.
+type countingAuthorizer struct {
+	Authorizer
+	consumes atomic.Int64
+}
+
+func (a *countingAuthorizer) Authorize(subject, object, action string) error {
+	if action == consumeAction {
+		a.consumes.Add(1)
+	}
+
+	return a.Authorizer.Authorize(subject, object, action)
+}
+
+func testConsumeStreamAuthorizeOnce(t *testing.T, client api.LogClient, authorizer *countingAuthorizer) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := client.ProduceBatch(ctx, &api.ProduceBatchRequest{
+		Records: []*api.Record{{Value: []byte("first")}, {Value: []byte("second")}},
+	})
+	testhelper.RequireNoError(t, err)
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{})
+	testhelper.RequireNoError(t, err)
+	for want := uint64(0); want < 2; want++ {
+		resp, err := stream.Recv()
+		testhelper.RequireNoError(t, err)
+		testhelper.AssertEqual(t, want, resp.Record.Offset)
+	}
+
+	_, err = client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("third")}})
+	testhelper.RequireNoError(t, err)
+	resp, err := stream.Recv()
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(2), resp.Record.Offset)
+
+	testhelper.AssertEqual(t, int64(1), authorizer.consumes.Load())
+}
+
+func testConsumeStreamLongPoll(t *testing.T, client api.LogClient) {
+	ctx := context.Background()
+	_, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	testhelper.RequireNoError(t, err)
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0})
+	testhelper.RequireNoError(t, err)
+
+	_, err = stream.Recv()
+	testhelper.RequireNoError(t, err)
+
+	_, err = stream.Recv()
+	testhelper.AssertError(t, io.EOF, err)
+}
+
+func testProduceBatch(t *testing.T, client api.LogClient) {
+	ctx := context.Background()
+	_, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	testhelper.RequireNoError(t, err)
+
+	records := []*api.Record{
+		{Value: []byte("first message")},
+		{Value: []byte("second message")},
+		{Value: []byte("third message")},
+	}
+	resp, err := client.ProduceBatch(ctx, &api.ProduceBatchRequest{Records: records})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(1), resp.FirstOffset)
+	testhelper.AssertEqual(t, uint64(3), resp.LastOffset)
+
+	for i, record := range records {
+		consumeResp, err := client.Consume(ctx, &api.ConsumeRequest{Offset: resp.FirstOffset + uint64(i)})
+		testhelper.AssertNoError(t, err)
+		testhelper.AssertEqual(t, record.Value, consumeResp.Record.Value)
+	}
+
+	_, err = client.ProduceBatch(ctx, &api.ProduceBatchRequest{})
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
+}
+
+func testConsumeRange(t *testing.T, client api.LogClient) {
+	ctx := context.Background()
+	var want [][]byte
+	for i := 0; i < 5; i++ {
+		value := []byte(fmt.Sprintf("record-%d", i))
+		_, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: value}})
+		testhelper.RequireNoError(t, err)
+		want = append(want, value)
+	}
+
+	var got [][]byte
+	offset := uint64(0)
+	for {
+		resp, err := client.ConsumeRange(ctx, &api.ConsumeRangeRequest{Offset: offset, MaxRecords: 2})
+		testhelper.RequireNoError(t, err)
+		if len(resp.Records) == 0 {
+			testhelper.AssertEqual(t, offset, resp.NextOffset)
+			break
+		}
+
+		testhelper.AssertEqual(t, true, len(resp.Records) <= 2)
+		for _, record := range resp.Records {
+			got = append(got, record.Value)
+		}
+		offset = resp.NextOffset
+	}
+	testhelper.AssertEqual(t, want, got)
+
+	// a page always holds a record, even one larger than max bytes
+	resp, err := client.ConsumeRange(ctx, &api.ConsumeRangeRequest{MaxBytes: 1})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, 1, len(resp.Records))
+	testhelper.AssertEqual(t, uint64(1), resp.NextOffset)
+}
+
+func testGetOffsets(t *testing.T, client api.LogClient) {
+	ctx := context.Background()
+	resp, err := client.GetOffsets(ctx, &api.GetOffsetsRequest{})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(0), resp.NextOffset)
+	testhelper.AssertEqual(t, uint32(1), resp.Segments)
+
+	for i := 0; i < 3; i++ {
+		_, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("offsets")}})
+		testhelper.RequireNoError(t, err)
+	}
+
+	resp, err = client.GetOffsets(ctx, &api.GetOffsetsRequest{})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(0), resp.LowestOffset)
+	testhelper.AssertEqual(t, uint64(2), resp.HighestOffset)
+	testhelper.AssertEqual(t, uint64(3), resp.NextOffset)
+	testhelper.AssertEqual(t, resp.CommitIndex, resp.AppliedIndex)
+
+	_, err = client.GetOffsets(ctx, &api.GetOffsetsRequest{Topic: "missing"})
+	testhelper.AssertEqual(t, codes.NotFound, status.Code(err))
+}
+
+func testTopics(t *testing.T, client api.LogClient) {
+	ctx := context.Background()
+	_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{Name: "orders"})
+	testhelper.RequireNoError(t, err)
+
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{Name: "orders"})
+	testhelper.AssertEqual(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{Name: "../orders"})
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
+
+	listResp, err := client.ListTopics(ctx, &api.ListTopicsRequest{})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, []string{api.DefaultTopic, "orders"}, listResp.Topics)
+
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("default message")},
+	})
+	testhelper.RequireNoError(t, err)
+
+	want := []byte("order message")
+	produceResp, err := client.Produce(ctx, &api.ProduceRequest{
+		Topic:  "orders",
+		Record: &api.Record{Value: want},
+	})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(0), produceResp.Offset)
+
+	consumeResp, err := client.Consume(ctx, &api.ConsumeRequest{Topic: "orders", Offset: 0})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, want, consumeResp.Record.Value)
+
+	_, err = client.DeleteTopic(ctx, &api.DeleteTopicRequest{Name: "orders"})
+	testhelper.RequireNoError(t, err)
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Topic: "orders", Offset: 0})
+	testhelper.AssertEqual(t, codes.NotFound, status.Code(err))
+
+	_, err = client.DeleteTopic(ctx, &api.DeleteTopicRequest{Name: api.DefaultTopic})
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
+}
+
+func testPartitions(t *testing.T, client api.LogClient) {
+	ctx := context.Background()
+	_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{Name: "orders", Partitions: 4})
+	testhelper.RequireNoError(t, err)
+
+	listResp, err := client.ListTopics(ctx, &api.ListTopicsRequest{})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint32(4), listResp.Partitions["orders"])
+	testhelper.AssertEqual(t, uint32(1), listResp.Partitions[api.DefaultTopic])
+
+	// the records of a key keep their order in a single partition
+	var partition uint32
+	for i := 0; i < 3; i++ {
+		resp, err := client.Produce(ctx, &api.ProduceRequest{
+			Topic:  "orders",
+			Record: &api.Record{Key: []byte("customer-1"), Value: []byte(fmt.Sprintf("order %d", i))},
+		})
+		testhelper.RequireNoError(t, err)
+		if i > 0 {
+			testhelper.AssertEqual(t, partition, resp.Partition)
+		}
+		partition = resp.Partition
+		testhelper.AssertEqual(t, uint64(i), resp.Offset)
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Consume(ctx, &api.ConsumeRequest{Topic: "orders", Partition: partition, Offset: uint64(i)})
+		testhelper.RequireNoError(t, err)
+		testhelper.AssertEqual(t, []byte(fmt.Sprintf("order %d", i)), resp.Record.Value)
+	}
+
+	// keyless records are spread across the partitions
+	seen := make(map[uint32]bool)
+	for i := 0; i < 4; i++ {
+		resp, err := client.Produce(ctx, &api.ProduceRequest{
+			Topic:  "orders",
+			Record: &api.Record{Value: []byte("keyless")},
+		})
+		testhelper.RequireNoError(t, err)
+		seen[resp.Partition] = true
+	}
+	testhelper.AssertEqual(t, 4, len(seen))
+
+	explicit := uint32(3)
+	resp, err := client.Produce(ctx, &api.ProduceRequest{
+		Topic:     "orders",
+		Partition: &explicit,
+		Record:    &api.Record{Key: []byte("customer-1"), Value: []byte("explicit")},
+	})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, explicit, resp.Partition)
+
+	batchResp, err := client.ProduceBatch(ctx, &api.ProduceBatchRequest{
+		Topic: "orders",
+		Records: []*api.Record{
+			{Key: []byte("customer-1"), Value: []byte("batched")},
+			{Key: []byte("customer-1"), Value: []byte("batched")},
+		},
+	})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, 1, len(batchResp.Partitions))
+	testhelper.AssertEqual(t, partition, batchResp.Partitions[0].Partition)
+	testhelper.AssertEqual(t, batchResp.FirstOffset+1, batchResp.LastOffset)
+
+	invalid := uint32(4)
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Topic:     "orders",
+		Partition: &invalid,
+		Record:    &api.Record{Value: []byte("invalid")},
+	})
+	testhelper.AssertEqual(t, codes.NotFound, status.Code(err))
+}
+
+func testCommittedOffsets(t *testing.T, client api.LogClient) {
+	ctx := context.Background()
+	_, err := client.FetchCommittedOffset(ctx, &api.FetchCommittedOffsetRequest{Group: "billing"})
+	testhelper.AssertEqual(t, codes.NotFound, status.Code(err))
+
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{Offset: 1})
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
+
+	// the group would run into the topic of the committed offset's key
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "billing\x00default", Offset: 1})
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "billing", Offset: 2})
+	testhelper.RequireNoError(t, err)
+
+	resp, err := client.FetchCommittedOffset(ctx, &api.FetchCommittedOffsetRequest{Group: "billing"})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(2), resp.Offset)
+
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Topic:  log.OffsetsTopic,
+		Record: &api.Record{Value: []byte("offset")},
+	})
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
+
+	// the commits of the other groups aren't readable by consumers
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Topic: log.OffsetsTopic})
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.ConsumeRange(ctx, &api.ConsumeRangeRequest{Topic: log.OffsetsTopic})
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Topic: log.OffsetsTopic})
+	testhelper.RequireNoError(t, err)
+	_, err = stream.Recv()
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
+}
+
+func testIdempotentProducer(t *testing.T, client api.LogClient) {
+	ctx := context.Background()
+	init, err := client.InitProducer(ctx, &api.InitProducerRequest{})
+	testhelper.RequireNoError(t, err)
+
+	req := &api.ProduceRequest{
+		Record:        &api.Record{Value: []byte("once")},
+		ProducerId:    init.ProducerId,
+		ProducerEpoch: init.ProducerEpoch,
+	}
+	first, err := client.Produce(ctx, req)
+	testhelper.RequireNoError(t, err)
+
+	// the retry gets the offset of the first append
+	retry, err := client.Produce(ctx, req)
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, first.Offset, retry.Offset)
+
+	req.Sequence = 1
+	next, err := client.Produce(ctx, req)
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, first.Offset+1, next.Offset)
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Offset: next.Offset + 1})
+	testhelper.AssertEqual(t, codes.NotFound, status.Code(err))
+
+	batch := &api.ProduceBatchRequest{
+		Records: []*api.Record{
+			{Value: []byte("second")},
+			{Value: []byte("third")},
+		},
+		ProducerId:    init.ProducerId,
+		ProducerEpoch: init.ProducerEpoch,
+		Sequence:      2,
+	}
+	batchResp, err := client.ProduceBatch(ctx, batch)
+	testhelper.RequireNoError(t, err)
+
+	batchRetry, err := client.ProduceBatch(ctx, batch)
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, batchResp.FirstOffset, batchRetry.FirstOffset)
+	testhelper.AssertEqual(t, batchResp.LastOffset, batchRetry.LastOffset)
+
+	// a new epoch of the producer fences off the old one
+	_, err = client.InitProducer(ctx, &api.InitProducerRequest{ProducerId: init.ProducerId})
+	testhelper.RequireNoError(t, err)
+
+	req.Sequence = 4
+	_, err = client.Produce(ctx, req)
+	testhelper.AssertEqual(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Record:     &api.Record{Value: []byte("unknown")},
+		ProducerId: init.ProducerId + 1,
+	})
+	testhelper.AssertEqual(t, codes.NotFound, status.Code(err))
+}
+
+func testLeaderAcks(t *testing.T, client api.LogClient) {
+	ctx := context.Background()
+	want := []byte("telemetry")
+	_, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: want},
+		Acks:   api.Acks_LEADER,
+	})
+	testhelper.RequireNoError(t, err)
+
+	batch, err := client.ProduceBatch(ctx, &api.ProduceBatchRequest{
+		Records: []*api.Record{{Value: want}, {Value: want}},
+		Acks:    api.Acks_LEADER,
+	})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(0), batch.LastOffset)
+
+	// the records are appended once raft commits them
+	require.Eventually(t, func() bool {
+		resp, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 2})
+		return err == nil && bytes.Equal(want, resp.Record.Value)
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func testTransactions(t *testing.T, client api.LogClient) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	producer, err := client.InitProducer(ctx, &api.InitProducerRequest{})
+	testhelper.RequireNoError(t, err)
+	other, err := client.InitProducer(ctx, &api.InitProducerRequest{})
+	testhelper.RequireNoError(t, err)
+
+	// the records of the transactions are produced by the producer that
+	// began them, numbered in sequence
+	var sequence uint64
+	txnProduce := func(value string, txnID uint64) (*api.ProduceResponse, error) {
+		return client.Produce(ctx, &api.ProduceRequest{
+			Record:        &api.Record{Value: []byte(value)},
+			ProducerId:    producer.ProducerId,
+			ProducerEpoch: producer.ProducerEpoch,
+			Sequence:      sequence,
+			TxnId:         txnID,
+		})
+	}
+	produce := func(value string, txnID uint64) {
+		t.Helper()
+		var err error
+		if txnID == 0 {
+			_, err = client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte(value)}})
+		} else {
+			_, err = txnProduce(value, txnID)
+			sequence++
+		}
+		testhelper.RequireNoError(t, err)
+	}
+
+	_, err = client.BeginTxn(ctx, &api.BeginTxnRequest{})
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
+
+	committed, err := client.BeginTxn(ctx, &api.BeginTxnRequest{ProducerId: producer.ProducerId})
+	testhelper.RequireNoError(t, err)
+	produce("committed", committed.TxnId)
+	produce("after", 0)
+
+	// another producer can't produce in the transaction or end it
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Record:     &api.Record{Value: []byte("intruder")},
+		ProducerId: other.ProducerId,
+		TxnId:      committed.TxnId,
+	})
+	testhelper.AssertEqual(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.CommitTxn(ctx, &api.CommitTxnRequest{TxnId: committed.TxnId, ProducerId: other.ProducerId})
+	testhelper.AssertEqual(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.AbortTxn(ctx, &api.AbortTxnRequest{TxnId: committed.TxnId})
+	testhelper.AssertEqual(t, codes.PermissionDenied, status.Code(err))
+
+	// the open transaction holds back the records after it
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Isolation: api.IsolationLevel_READ_COMMITTED})
+	testhelper.AssertEqual(t, codes.NotFound, status.Code(err))
+
+	resp, err := client.Consume(ctx, &api.ConsumeRequest{})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, []byte("committed"), resp.Record.Value)
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Isolation: api.IsolationLevel_READ_COMMITTED})
+	testhelper.RequireNoError(t, err)
+
+	aborted, err := client.BeginTxn(ctx, &api.BeginTxnRequest{ProducerId: producer.ProducerId})
+	testhelper.RequireNoError(t, err)
+	produce("aborted", aborted.TxnId)
+	_, err = client.AbortTxn(ctx, &api.AbortTxnRequest{TxnId: aborted.TxnId, ProducerId: producer.ProducerId})
+	testhelper.RequireNoError(t, err)
+	produce("last", 0)
+
+	_, err = client.CommitTxn(ctx, &api.CommitTxnRequest{TxnId: committed.TxnId, ProducerId: producer.ProducerId})
+	testhelper.RequireNoError(t, err)
+
+	for _, want := range []string{"committed", "after", "last"} {
+		resp, err := stream.Recv()
+		testhelper.RequireNoError(t, err)
+		testhelper.AssertEqual(t, []byte(want), resp.Record.Value)
+	}
+
+	_, err = client.CommitTxn(ctx, &api.CommitTxnRequest{TxnId: committed.TxnId, ProducerId: producer.ProducerId})
+	testhelper.AssertEqual(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = txnProduce("late", aborted.TxnId)
+	testhelper.AssertEqual(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func testConsumerGroups(t *testing.T, client api.LogClient) {
+	ctx := context.Background()
+	_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{Name: "orders", Partitions: 4})
+	testhelper.RequireNoError(t, err)
+
+	_, err = client.JoinGroup(ctx, &api.JoinGroupRequest{Group: "billing\x00orders", Topic: "orders"})
+	testhelper.AssertEqual(t, codes.InvalidArgument, status.Code(err))
+
+	first, err := client.JoinGroup(ctx, &api.JoinGroupRequest{Group: "billing", Topic: "orders"})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, []uint32{0, 1, 2, 3}, first.Partitions)
+
+	second, err := client.JoinGroup(ctx, &api.JoinGroupRequest{Group: "billing", Topic: "orders"})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, first.Generation+1, second.Generation)
+	testhelper.AssertEqual(t, 2, len(second.Partitions))
+
+	// the first member learns about the rebalance from its heartbeat
+	_, err = client.Heartbeat(ctx, &api.HeartbeatRequest{
+		Group:      "billing",
+		Topic:      "orders",
+		MemberId:   first.MemberId,
+		Generation: first.Generation,
+	})
+	testhelper.AssertEqual(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{
+		Group:      "billing",
+		Topic:      "orders",
+		Partition:  first.Partitions[0],
+		Offset:     1,
+		MemberId:   first.MemberId,
+		Generation: first.Generation,
+	})
+	testhelper.AssertEqual(t, codes.FailedPrecondition, status.Code(err))
+
+	rejoined, err := client.JoinGroup(ctx, &api.JoinGroupRequest{
+		Group:    "billing",
+		Topic:    "orders",
+		MemberId: first.MemberId,
+	})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, second.Generation, rejoined.Generation)
+
+	assigned := make(map[uint32]bool)
+	for _, p := range append(rejoined.Partitions, second.Partitions...) {
+		assigned[p] = true
+	}
+	testhelper.AssertEqual(t, 4, len(assigned))
+
+	_, err = client.Heartbeat(ctx, &api.HeartbeatRequest{
+		Group:      "billing",
+		Topic:      "orders",
+		MemberId:   rejoined.MemberId,
+		Generation: rejoined.Generation,
+	})
+	testhelper.AssertNoError(t, err)
+
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{
+		Group:      "billing",
+		Topic:      "orders",
+		Partition:  second.Partitions[0],
+		Offset:     1,
+		MemberId:   rejoined.MemberId,
+		Generation: rejoined.Generation,
+	})
+	testhelper.AssertNotEqual(t, nil, err)
+
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{
+		Group:      "billing",
+		Topic:      "orders",
+		Partition:  rejoined.Partitions[0],
+		Offset:     1,
+		MemberId:   rejoined.MemberId,
+		Generation: rejoined.Generation,
+	})
+	testhelper.AssertNoError(t, err)
+
+	_, err = client.LeaveGroup(ctx, &api.LeaveGroupRequest{
+		Group:    "billing",
+		Topic:    "orders",
+		MemberId: second.MemberId,
+	})
+	testhelper.RequireNoError(t, err)
+
+	// a member without heartbeats is removed once its session times out
+	_, err = client.JoinGroup(ctx, &api.JoinGroupRequest{
+		Group:            "shipping",
+		Topic:            "orders",
+		SessionTimeoutMs: 200,
+	})
+	testhelper.RequireNoError(t, err)
+
+	require.Eventually(t, func() bool {
+		res, err := client.JoinGroup(ctx, &api.JoinGroupRequest{
+			Group:    "billing",
+			Topic:    "orders",
+			MemberId: rejoined.MemberId,
+		})
+
+		return err == nil && len(res.Partitions) == 4
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		res, err := client.JoinGroup(ctx, &api.JoinGroupRequest{Group: "shipping", Topic: "orders"})
+		if err != nil {
+			return false
+		}
+
+		_, err = client.LeaveGroup(ctx, &api.LeaveGroupRequest{Group: "shipping", Topic: "orders", MemberId: res.MemberId})
+
+		return err == nil && len(res.Partitions) == 4
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
 func setupClient(t *testing.T, certPath, keyPath, address string) (api.LogClient, *grpc.ClientConn, error) {
 	clientTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
 		CertFile: certPath,
@@ -243,6 +998,12 @@ func testAuthorization(t *testing.T, nobodyClient api.LogClient) {
 	gotCode := status.Code(err)
 	testhelper.AssertEqual(t, wantCode, gotCode)
 
+	_, err = nobodyClient.ProduceBatch(ctx, &api.ProduceBatchRequest{
+		Records: []*api.Record{produceReq.Record},
+	})
+	gotCode = status.Code(err)
+	testhelper.AssertEqual(t, wantCode, gotCode)
+
 	consumeReq := &api.ConsumeRequest{
 		Offset: 0,
 	}
@@ -250,4 +1011,40 @@ func testAuthorization(t *testing.T, nobodyClient api.LogClient) {
 	wantCode = codes.PermissionDenied
 	gotCode = status.Code(err)
 	testhelper.AssertEqual(t, wantCode, gotCode)
+
+	_, err = nobodyClient.CreateTopic(ctx, &api.CreateTopicRequest{Name: "orders"})
+	gotCode = status.Code(err)
+	testhelper.AssertEqual(t, wantCode, gotCode)
+
+	listResp, err := nobodyClient.ListTopics(ctx, &api.ListTopicsRequest{})
+	testhelper.AssertNoError(t, err)
+	testhelper.AssertEqual(t, 0, len(listResp.GetTopics()))
+}
+
+func testOffsetsForTime(t *testing.T, client api.LogClient) {
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{
+				Value: []byte("hello world"),
+			},
+		})
+		testhelper.RequireNoError(t, err)
+	}
+
+	consumeResp, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 1})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertNotEqual(t, int64(0), consumeResp.Record.Timestamp)
+
+	resp, err := client.OffsetsForTime(ctx, &api.OffsetsForTimeRequest{
+		Timestamp: consumeResp.Record.Timestamp,
+	})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(1), resp.Offset)
+
+	resp, err = client.OffsetsForTime(ctx, &api.OffsetsForTimeRequest{
+		Timestamp: time.Now().Add(time.Hour).UnixNano(),
+	})
+	testhelper.RequireNoError(t, err)
+	testhelper.AssertEqual(t, uint64(3), resp.Offset)
 }
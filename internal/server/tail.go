@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	api "github.com/huytran2000-hcmus/proglog/api/v1"
+)
+
+// lastEventIDParam stands in for the Last-Event-ID header for the clients
+// that can't set it, like browsers opening a WebSocket.
+const lastEventIDParam = "last_event_id"
+
+// tail serves GET /v1/tail, which follows a partition like ConsumeStream.
+// The ConsumeRequest is given as query parameters: topic, partition,
+// offset, isolation, consistency and filter, the enums by name. A client
+// reconnecting with the Last-Event-ID header, or the last_event_id
+// parameter, resumes after that offset.
+//
+// The records are sent as Server-Sent Events, with their offset as the event
+// ID, unless the request upgrades to a WebSocket, which gets a text message
+// per record, and which browsers may only open from the allowed origins.
+// Both carry the record in the JSON mapping of protobuf. An error ending the
+// stream is sent as an error event, or as the last message, in the body of
+// the errors of the other endpoints. The stream ends without an error when
+// the long-poll timeout passes, for the client to reconnect.
+func (s *grpcServer) tail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeHTTPError(w, status.Error(codes.Unimplemented, "method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := tailRequest(r)
+	if err != nil {
+		writeHTTPError(w, err, 0)
+		return
+	}
+
+	f, err := newFilter(req.Filter)
+	if err != nil {
+		writeHTTPError(w, err, 0)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), subjectContextKey{}, tlsSubject(r.TLS))
+	err = s.Authorizer.Authorize(subject(ctx), object(req.Topic), consumeAction)
+	if err != nil {
+		writeHTTPError(w, fmt.Errorf("failed authorization: %w", err), 0)
+		return
+	}
+
+	err = consumable(req.Topic)
+	if err != nil {
+		writeHTTPError(w, err, 0)
+		return
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		ws := websocket.Server{
+			Handshake: s.checkOrigin,
+			Handler: func(conn *websocket.Conn) {
+				s.tailWebSocket(ctx, conn, req, f)
+			},
+		}
+		ws.ServeHTTP(w, r)
+		return
+	}
+
+	s.tailEvents(ctx, w, req, f)
+}
+
+// tailEvents streams the records as Server-Sent Events.
+func (s *grpcServer) tailEvents(ctx context.Context, w http.ResponseWriter, req *api.ConsumeRequest, f *filter) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeHTTPError(w, status.Error(codes.Unimplemented, "streaming unsupported"), 0)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	err := s.follow(ctx, req, f, func(res *api.ConsumeResponse) error {
+		b, err := protojson.Marshal(res.Record)
+		if err != nil {
+			return status.Errorf(codes.Internal, "encode record: %s", err)
+		}
+
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", res.Record.Offset, b)
+		if err != nil {
+			return err
+		}
+		flusher.Flush()
+
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", httpErrorBody(err))
+		flusher.Flush()
+	}
+}
+
+// tailWebSocket streams the records as WebSocket messages. The messages the
+// client sends are discarded, the stream ends once it closes the connection.
+func (s *grpcServer) tailWebSocket(ctx context.Context, conn *websocket.Conn, req *api.ConsumeRequest, f *filter) {
+	// the server stops watching a hijacked connection, so the request
+	// context isn't done when it closes
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		defer cancel()
+		var msg []byte
+		for websocket.Message.Receive(conn, &msg) == nil {
+		}
+	}()
+
+	err := s.follow(ctx, req, f, func(res *api.ConsumeResponse) error {
+		b, err := protojson.Marshal(res.Record)
+		if err != nil {
+			return status.Errorf(codes.Internal, "encode record: %s", err)
+		}
+
+		return websocket.Message.Send(conn, string(b))
+	})
+	if err != nil && ctx.Err() == nil {
+		_ = websocket.Message.Send(conn, string(httpErrorBody(err)))
+	}
+
+	_ = conn.Close()
+}
+
+// checkOrigin rejects the WebSockets opened by a page of an origin that is
+// neither the server's host nor an allowed one, so a page of any site can't
+// read the log with the client certificate of the browser visiting it.
+// Clients other than browsers may send no origin.
+func (s *grpcServer) checkOrigin(_ *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("parse origin %q: %w", origin, err)
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+
+	for _, allowed := range s.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("origin %s not allowed", origin)
+}
+
+// tailRequest reads the ConsumeRequest of a tail from the query parameters.
+func tailRequest(r *http.Request) (*api.ConsumeRequest, error) {
+	query := r.URL.Query()
+	req := &api.ConsumeRequest{
+		Topic:  query.Get("topic"),
+		Filter: query.Get("filter"),
+	}
+
+	if v := query.Get("partition"); v != "" {
+		partition, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid partition %q", v)
+		}
+		req.Partition = uint32(partition)
+	}
+
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid offset %q", v)
+		}
+		req.Offset = offset
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get(lastEventIDParam)
+	}
+	if lastEventID != "" {
+		offset, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid last event ID %q", lastEventID)
+		}
+		req.Offset = offset + 1
+	}
+
+	if v := query.Get("isolation"); v != "" {
+		isolation, ok := api.IsolationLevel_value[strings.ToUpper(v)]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid isolation %q", v)
+		}
+		req.Isolation = api.IsolationLevel(isolation)
+	}
+
+	if v := query.Get("consistency"); v != "" {
+		consistency, ok := api.Consistency_value[strings.ToUpper(v)]
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid consistency %q", v)
+		}
+		req.Consistency = api.Consistency(consistency)
+	}
+
+	return req, nil
+}